@@ -1,8 +1,14 @@
 package main
 
 import (
-	"math/rand"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"log"
@@ -10,14 +16,71 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/meddion/web-blog/pkg/config"
 	h "github.com/meddion/web-blog/pkg/handlers"
+	"github.com/meddion/web-blog/pkg/mail"
+	"github.com/meddion/web-blog/pkg/models"
+	"github.com/meddion/web-blog/pkg/models/memory"
+	"github.com/meddion/web-blog/pkg/search"
+	"github.com/meddion/web-blog/pkg/session"
+	cookiesession "github.com/meddion/web-blog/pkg/session/providers/cookie"
+	filesession "github.com/meddion/web-blog/pkg/session/providers/file"
+	memsession "github.com/meddion/web-blog/pkg/session/providers/memory"
+	mongosession "github.com/meddion/web-blog/pkg/session/providers/mongo"
+	"github.com/meddion/web-blog/pkg/sitemap"
+	"github.com/meddion/web-blog/pkg/throttle"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+const sessionsCollection = "sessions"
+
 // In main we set up our endpoints (along with middleware)
 // and start listening for upcoming requests
 func main() {
 	// Getting our config struct
 	conf := config.GetConf()
 
+	// Setting up the storage
+	stores, db, err := openStores(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := search.Attach(context.Background(), stores); err != nil {
+		log.Fatalf("on building the search index: %s", err.Error())
+	}
+	mailer, err := newMailer(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts := h.Options{
+		Domain:         conf.Server.Domain,
+		Mailer:         mailer,
+		Sitemaps:       sitemap.Attach(stores),
+		RobotsDisallow: conf.Robots.Disallow,
+		TrustProxy:     conf.Server.TrustProxy,
+		MaxUploadSize:  conf.Server.MaxUploadSize,
+		LoginAccounts: throttle.New(throttle.NewMemoryStore(), throttle.Policy{
+			Free: conf.Throttle.AccountAttempts,
+			Base: conf.Throttle.Lockout,
+			Max:  conf.Throttle.MaxLockout,
+		}),
+		LoginAddresses: throttle.New(throttle.NewMemoryStore(), throttle.Policy{
+			Free: conf.Throttle.AddressAttempts,
+			Base: conf.Throttle.Lockout,
+			Max:  conf.Throttle.MaxLockout,
+		}),
+	}
+	if conf.Robots.Path != "" {
+		robots, err := ioutil.ReadFile(conf.Robots.Path)
+		if err != nil {
+			log.Fatalf("on reading robots.txt: %s", err.Error())
+		}
+		opts.Robots = string(robots)
+	}
+	srv := h.NewServer(stores, opts)
+	if err := bootstrapInvite(context.Background(), stores); err != nil {
+		log.Fatalf("on creating the first invite: %s", err.Error())
+	}
+	go models.PublishScheduled(context.Background(), stores.Posts, 30*time.Second)
+
 	// Creating our router
 	r := mux.NewRouter()
 
@@ -26,55 +89,136 @@ func main() {
 		http.Redirect(w, r, conf.Server.Domain, http.StatusSeeOther)
 	})
 
+	// Feeds of published posts
+	r.HandleFunc("/feed.rss", srv.RSSFeedHandler).Methods("GET")
+	r.HandleFunc("/feed.atom", srv.AtomFeedHandler).Methods("GET")
+
+	// Helping search engines to find posts
+	r.HandleFunc("/sitemap.xml", srv.SitemapHandler).Methods("GET")
+	r.HandleFunc("/sitemap-{n:[0-9]+}.xml", srv.SitemapPartHandler).Methods("GET")
+	r.HandleFunc("/robots.txt", srv.RobotsHandler).Methods("GET")
+
 	// Setting up endpoints with /api prefix in common
 	api := r.PathPrefix("/api").Subrouter()
 
 	// Serving static files and manipulating with them
 	static := api.PathPrefix("/static").Subrouter()
-	static.HandleFunc("/{path:.*}", h.AddFileHandler).Methods("POST")
-	static.HandleFunc("/{path:.*}", h.DeleteFileHandler).Methods("DELETE")
-	static.HandleFunc("/filenames/{path:.*}", h.GetFilenamesHandler).Methods("GET")
-	static.HandleFunc("/{path:.*}", h.StaticHandler).Methods("GET")
+	static.HandleFunc("/{path:.*}", srv.AddFileHandler).Methods("POST")
+	static.HandleFunc("/{path:.*}", srv.DeleteFileHandler).Methods("DELETE")
+	static.HandleFunc("/filenames/{path:.*}", srv.GetFilenamesHandler).Methods("GET")
+	static.HandleFunc("/{path:.*}", srv.StaticHandler).Methods("GET")
 
 	accountRouter := api.PathPrefix("/account").Subrouter()
-	accountRouter.HandleFunc("/login", h.LoginHandler).Methods("POST")
-	accountRouter.HandleFunc("/logout", h.LogoutHandler).Methods("POST", "GET")
+	accountRouter.HandleFunc("/login", srv.LoginHandler).Methods("POST")
+	accountRouter.HandleFunc("/login/2fa", srv.LoginSecondFactorHandler).Methods("POST")
+	accountRouter.HandleFunc("/2fa/enroll", srv.EnrollTOTPHandler).Methods("POST")
+	accountRouter.HandleFunc("/2fa/confirm", srv.ConfirmTOTPHandler).Methods("POST")
+	accountRouter.HandleFunc("/2fa", srv.DisableTOTPHandler).Methods("DELETE")
+	accountRouter.HandleFunc("/tokens", srv.GetAPITokensHandler).Methods("GET")
+	accountRouter.HandleFunc("/tokens", srv.CreateAPITokenHandler).Methods("POST")
+	accountRouter.HandleFunc("/tokens/{id}", srv.RevokeAPITokenHandler).Methods("DELETE")
+	accountRouter.HandleFunc("/sessions", srv.GetSessionsHandler).Methods("GET")
+	accountRouter.HandleFunc("/sessions", srv.DeleteOtherSessionsHandler).Methods("DELETE")
+	accountRouter.HandleFunc("/sessions/{id}", srv.DeleteSessionHandler).Methods("DELETE")
+	accountRouter.HandleFunc("/logout", srv.LogoutHandler).Methods("POST", "GET")
 
-	signupHash := genRandSeqOfLen(32)
-	accountRouter.HandleFunc("/signup/"+signupHash, h.SignupHandler).Methods("POST")
-	log.Printf("To register follow \"/api/account/signup/%s\"", signupHash)
-	log.Printf(`{"name":"<new-login>","password": "<new-password>"}`)
+	accountRouter.HandleFunc("/signup", srv.SignupHandler).Methods("POST")
+	accountRouter.HandleFunc("/password-reset", srv.RequestPasswordResetHandler).Methods("POST")
+	accountRouter.HandleFunc("/password-reset/complete", srv.CompletePasswordResetHandler).Methods("POST")
 
-	accountRouter.HandleFunc("/{name}", h.GetAccountByNameHandler).Methods("GET")
-	accountRouter.HandleFunc("/", h.GetAccountHandler).Methods("GET")
-	accountRouter.HandleFunc("/", h.UpdateAccountHandler).Methods("PUT")
-	accountRouter.HandleFunc("/", h.DeleteAccountHandler).Methods("DELETE")
+	accountRouter.HandleFunc("/{name}", srv.GetAccountByNameHandler).Methods("GET")
+	accountRouter.HandleFunc("/{name}/role", srv.SetRoleHandler).Methods("PUT")
+	accountRouter.HandleFunc("/", srv.GetAccountHandler).Methods("GET")
+	accountRouter.HandleFunc("/", srv.UpdateAccountHandler).Methods("PUT")
+	accountRouter.HandleFunc("/", srv.DeleteAccountHandler).Methods("DELETE")
 
 	postsRouter := api.PathPrefix("/posts").Subrouter()
-	postsRouter.HandleFunc("/info", h.GetPostsInfoHandler).Methods("GET")
-	postsRouter.HandleFunc("/{pageNum:[0-9]+}", h.GetPostsHandler).Methods("GET")
+	postsRouter.HandleFunc("/info", srv.GetPostsInfoHandler).Methods("GET")
+	postsRouter.HandleFunc("/{pageNum:[0-9]+}", srv.GetPostsHandler).Methods("GET")
+
+	api.HandleFunc("/tags", srv.GetTagsHandler).Methods("GET")
+	api.HandleFunc("/search", srv.SearchHandler).Methods("GET")
 
 	postRouter := api.PathPrefix("/post").Subrouter()
-	postRouter.HandleFunc("/{id}", h.GetPostHandler).Methods("GET")
-	postRouter.HandleFunc("/", h.CreatePostHandler).Methods("POST")
-	postRouter.HandleFunc("/", h.UpdatePostHandler).Methods("PUT")
-	postRouter.HandleFunc("/{id}", h.DeletePostHandler).Methods("DELETE")
+	postRouter.HandleFunc("/by-slug/{slug}", srv.GetPostBySlugHandler).Methods("GET")
+	postRouter.HandleFunc("/{id}", srv.GetPostHandler).Methods("GET")
+	postRouter.HandleFunc("/", srv.CreatePostHandler).Methods("POST")
+	postRouter.HandleFunc("/", srv.UpdatePostHandler).Methods("PUT")
+	postRouter.HandleFunc("/{id}", srv.DeletePostHandler).Methods("DELETE")
+	postRouter.HandleFunc("/{id}/revisions", srv.GetRevisionsHandler).Methods("GET")
+	postRouter.HandleFunc("/{id}/revisions/diff", srv.GetRevisionsDiffHandler).Methods("GET")
+	postRouter.HandleFunc("/{id}/revisions/{rev:[0-9]+}", srv.GetRevisionHandler).Methods("GET")
+	postRouter.HandleFunc("/{id}/revisions/{rev:[0-9]+}/restore", srv.RestoreRevisionHandler).Methods("POST")
+	postRouter.HandleFunc("/{id}/comments", srv.GetCommentsHandler).Methods("GET")
+	postRouter.HandleFunc("/{id}/comments", srv.AddCommentHandler).Methods("POST")
+
+	// Inviting new users
+	api.HandleFunc("/invites", srv.GetInvitesHandler).Methods("GET")
+	api.HandleFunc("/invite/", srv.CreateInviteHandler).Methods("POST")
+	api.HandleFunc("/invite/{id}", srv.RevokeInviteHandler).Methods("DELETE")
+
+	// Auditing lockouts of logging in
+	api.HandleFunc("/lockouts", srv.GetLockoutsHandler).Methods("GET")
+
+	// Moderating comments
+	api.HandleFunc("/comments", srv.GetCommentsQueueHandler).Methods("GET")
+	api.HandleFunc("/comment/{id}", srv.ModerateCommentHandler).Methods("PUT")
+	api.HandleFunc("/comment/{id}", srv.DeleteCommentHandler).Methods("DELETE")
 
 	// Setting up our session-auth middleware
+	manager, err := newSessionManager(conf, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go manager.GC(context.Background(), time.Minute)
 	// Passing routes that do not require authorization to NewSessionAuthMiddleware
-	sessionAuthMiddleware, err := h.NewSessionAuthMiddleware(
+	sessionAuthMiddleware := h.NewSessionAuthMiddleware(manager, stores.Users, stores.Tokens,
 		"/api/static/{path:.*}",
 		"/api/static/filenames/{path:.*}",
 		"/api/account/login",
-		"/api/account/signup/"+signupHash,
+		"/api/account/login/2fa",
+		"/api/account/signup",
+		"/api/account/password-reset",
+		"/api/account/password-reset/complete",
 		"/api/account/{name}",
 		"/api/posts/info",
+		"/api/tags",
+		"/api/search",
 		"/api/posts/{pageNum:[0-9]+}",
 		"/api/post/{id}",
+		"/api/post/by-slug/{slug}",
+		"/api/post/{id}/comments",
+		"/feed.rss",
+		"/feed.atom",
+		"/sitemap.xml",
+		"/sitemap-{n:[0-9]+}.xml",
+		"/robots.txt",
 	)
-	if err != nil {
-		log.Panic(err)
-	}
+	// Limiting the routes which change the blog to the roles allowed to
+	sessionAuthMiddleware.Require(models.PermWritePosts,
+		"POST /api/post/",
+		"PUT /api/post/",
+		"DELETE /api/post/{id}",
+		"GET /api/post/{id}/revisions",
+		"GET /api/post/{id}/revisions/diff",
+		"GET /api/post/{id}/revisions/{rev:[0-9]+}",
+		"POST /api/post/{id}/revisions/{rev:[0-9]+}/restore",
+	)
+	sessionAuthMiddleware.Require(models.PermModerateComments,
+		"GET /api/comments",
+		"PUT /api/comment/{id}",
+		"DELETE /api/comment/{id}",
+	)
+	sessionAuthMiddleware.Require(models.PermUploadFiles, "POST /api/static/{path:.*}")
+	sessionAuthMiddleware.Require(models.PermDeleteFiles, "DELETE /api/static/{path:.*}")
+	sessionAuthMiddleware.Require(models.PermManageUsers,
+		"PUT /api/account/{name}/role",
+		"GET /api/invites",
+		"POST /api/invite/",
+		"DELETE /api/invite/{id}",
+		"GET /api/lockouts",
+	)
+	sessionAuthMiddleware.Stream("GET /api/static/{path:.*}", "POST /api/static/{path:.*}")
 	r.Use(sessionAuthMiddleware.Middleware)
 
 	// Running the server with a given configuration
@@ -83,16 +227,146 @@ func main() {
 		Addr:         ":" + conf.Server.Port,
 		WriteTimeout: 15 * time.Second,
 		ReadTimeout:  15 * time.Second,
+		// Handlers streaming files extend the deadlines of connections
+		ConnContext: h.ConnContext,
 	}
 	log.Fatal(server.ListenAndServe())
 }
 
-func genRandSeqOfLen(n int) string {
-	rand.Seed(time.Now().UnixNano())
-	var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
-	b := make([]rune, n)
-	for i := range b {
-		b[i] = letters[rand.Intn(len(letters))]
+// openStores returns stores of the storage driver chosen in the config,
+// along with the database of the "mongo" driver (nil for the others)
+func openStores(conf *config.Config) (*models.Stores, *mongo.Database, error) {
+	switch conf.Db.Driver {
+	case "mongo":
+		if conf.Db.URI == "" || conf.Db.Name == "" {
+			return nil, nil, fmt.Errorf("DB_URI and DB_NAME are required by the %q driver", conf.Db.Driver)
+		}
+		db, err := models.ConnectMongo(conf.Db.URI, conf.Db.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := models.CreateIndexes(db); err != nil {
+			return nil, nil, err
+		}
+		return models.NewMongoStores(db), db, nil
+	case "memory":
+		return memory.NewStores(), nil, nil
+	case "file":
+		stores, err := memory.OpenStores(conf.Db.Path)
+		return stores, nil, err
+	}
+	return nil, nil, fmt.Errorf("on getting an unknown storage driver: %q", conf.Db.Driver)
+}
+
+// newSessionManager returns the manager of sessions kept by the provider chosen in the config,
+// the "mongo" provider uses db if the stores are kept in MongoDB as well
+func newSessionManager(conf *config.Config, db *mongo.Database) (*session.Manager, error) {
+	idle := conf.Session.IdleTimeout
+	switch conf.Session.Provider {
+	case "memory":
+		session.Register("memory", memsession.New(idle))
+	case "mongo":
+		if db == nil {
+			var err error
+			if db, err = models.ConnectMongo(conf.Db.URI, conf.Db.Name); err != nil {
+				return nil, err
+			}
+		}
+		provider, err := mongosession.New(db.Collection(sessionsCollection), idle)
+		if err != nil {
+			return nil, err
+		}
+		session.Register("mongo", provider)
+	case "file":
+		provider, err := filesession.New(conf.Session.Path, idle)
+		if err != nil {
+			return nil, err
+		}
+		session.Register("file", provider)
+	case "cookie":
+		keys := make([][]byte, 0, len(conf.Session.Keys))
+		for _, k := range conf.Session.Keys {
+			key, err := base64.StdEncoding.DecodeString(k)
+			if err != nil {
+				return nil, fmt.Errorf("on decoding a session key: %s", err.Error())
+			}
+			keys = append(keys, key)
+		}
+		provider, err := cookiesession.New(keys, idle)
+		if err != nil {
+			return nil, err
+		}
+		session.Register("cookie", provider)
+	}
+	cookie := session.CookieOptions{
+		Secure: conf.Session.Secure,
+		Domain: conf.Session.CookieDomain,
+		MaxAge: conf.Session.CookieMaxAge,
+	}
+	switch strings.ToLower(conf.Session.SameSite) {
+	case "lax":
+		cookie.SameSite = http.SameSiteLaxMode
+	case "strict":
+		cookie.SameSite = http.SameSiteStrictMode
+	case "none":
+		if !cookie.Secure {
+			return nil, errors.New("SESSION_SAME_SITE=none requires SESSION_SECURE=true")
+		}
+		cookie.SameSite = http.SameSiteNoneMode
+	default:
+		return nil, fmt.Errorf("on getting an unknown SameSite mode of the session cookie: %q", conf.Session.SameSite)
+	}
+	manager, err := session.NewManager(conf.Session.Provider, "SESSION_ID", session.Timeouts{
+		Idle:     idle,
+		Absolute: conf.Session.AbsoluteTimeout,
+	}, cookie)
+	if err != nil {
+		return nil, fmt.Errorf("on initializing the session manager: %s", err.Error())
+	}
+	return manager, nil
+}
+
+// newMailer returns the mailer chosen in the config
+func newMailer(conf *config.Config) (mail.Mailer, error) {
+	switch conf.Mail.Driver {
+	case "smtp":
+		if conf.Mail.SMTPAddr == "" {
+			return nil, errors.New("MAIL_SMTP_ADDR is required by the \"smtp\" mail driver")
+		}
+		return &mail.SMTPMailer{
+			Addr:     conf.Mail.SMTPAddr,
+			From:     conf.Mail.From,
+			Username: conf.Mail.Username,
+			Password: conf.Mail.Password,
+		}, nil
+	case "log":
+		if conf.Mail.Path == "" {
+			return &mail.WriterMailer{W: os.Stderr, From: conf.Mail.From}, nil
+		}
+		f, err := os.OpenFile(conf.Mail.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("on opening the mail log: %s", err.Error())
+		}
+		return &mail.WriterMailer{W: f, From: conf.Mail.From}, nil
+	}
+	return nil, fmt.Errorf("on getting an unknown mail driver: %q", conf.Mail.Driver)
+}
+
+// bootstrapInvite logs an invite for the first admin if there are no admins yet,
+// e.g. accounts made before roles were introduced are readers, so an admin has to promote them
+func bootstrapInvite(ctx context.Context, stores *models.Stores) error {
+	numOfAdmins, err := stores.Users.CountByRole(ctx, models.RoleAdmin)
+	if err != nil || numOfAdmins > 0 {
+		return err
+	}
+	invite, token, err := models.NewInvite(models.RoleAdmin, 1, 24*time.Hour)
+	if err != nil {
+		return err
+	}
+	if err := stores.Invites.Create(ctx, invite); err != nil {
+		return err
 	}
-	return string(b)
+	log.Printf("There are no admins yet, to register one POST to \"/api/account/signup\" within 24 hours:")
+	log.Printf(`{"name":"<new-login>","password":"<new-password>","invite":"%s"}`, token)
+	return nil
 }
@@ -2,6 +2,7 @@ package config
 
 import (
 	"log"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
@@ -10,13 +11,50 @@ import (
 // Config is a struct that encapsulates configuration variables for our application.
 type Config struct {
 	Db struct {
-		Name string `required:"true"`
-		URI  string `required:"true"`
+		Driver string `default:"mongo"` // "mongo", "memory" or "file"
+		Name   string
+		URI    string
+		Path   string `default:"blog.db"` // the data file of the "file" driver
 	}
 	Server struct {
 		Port          string `envconfig:"port" required:"true"`
 		OriginAllowed string `default:"*" split_words:"true"`
 		Domain        string `required:"true"`
+		TrustProxy    bool   `split_words:"true"` // take client addresses from X-Forwarded-For
+		// The limit of the size of uploaded files in bytes (64MB), no limit if it's zero
+		MaxUploadSize int64 `default:"67108864" split_words:"true"`
+	}
+	Session struct {
+		Provider string `default:"memory"`   // "memory", "mongo" (uses the database of Db), "file" or "cookie"
+		Path     string `default:"sessions"` // the directory of the "file" provider
+		// Base64 encoded AES keys of the "cookie" provider, comma-separated & newest first
+		Keys []string
+		// Attributes of the session cookie, a client on another site requires "none" SameSite along with Secure
+		Secure       bool
+		SameSite     string `default:"lax" split_words:"true"` // "lax", "strict" or "none"
+		CookieDomain string `split_words:"true"`
+		CookieMaxAge int    `split_words:"true"` // in seconds, the cookie doesn't outlive the browser if it's zero
+		// Sessions expire after being idle for IdleTimeout or lasting for AbsoluteTimeout (no limit if it's zero)
+		IdleTimeout     time.Duration `default:"30m" split_words:"true"`
+		AbsoluteTimeout time.Duration `default:"24h" split_words:"true"`
+	}
+	Mail struct {
+		Driver   string `default:"log"` // "log" or "smtp"
+		Path     string // the file the "log" driver appends emails to, stderr if it's empty
+		From     string `default:"blog@localhost"`
+		SMTPAddr string `envconfig:"smtp_addr"` // host:port of the "smtp" driver
+		Username string
+		Password string
+	}
+	Throttle struct {
+		AccountAttempts int           `default:"5" split_words:"true"`  // failed logins per account before lockouts
+		AddressAttempts int           `default:"20" split_words:"true"` // failed logins per client address before lockouts
+		Lockout         time.Duration `default:"30s"`                   // the first lockout, every next one is doubled
+		MaxLockout      time.Duration `default:"1h" split_words:"true"`
+	}
+	Robots struct {
+		Disallow []string `default:"/api/"` // paths crawlers are asked not to visit, comma-separated
+		Path     string   // a robots.txt file to serve instead of the generated one
 	}
 }
 
@@ -0,0 +1,110 @@
+// Package diff computes line-based differences between texts
+package diff
+
+import (
+	"errors"
+	"strings"
+)
+
+// MaxCells is the largest product of the numbers of changed lines in both texts, which Lines compares
+// (the LCS table of them takes 4 bytes per cell)
+const MaxCells = 1 << 22
+
+// ErrTooLarge is returned by Lines when the texts differ in too many lines
+var ErrTooLarge = errors.New("on comparing texts which differ in too many lines")
+
+// Types of Op
+const (
+	Equal  = "equal"
+	Insert = "insert"
+	Delete = "delete"
+)
+
+// Op is a run of lines which are the same in both texts, or only in one of them
+type Op struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Lines returns the ops turning a into b, found via the longest common subsequence of their lines,
+// ErrTooLarge is returned if the lines which differ need a table of more than MaxCells
+func Lines(a, b string) ([]Op, error) {
+	x, y := split(a), split(b)
+
+	// Common prefix & suffix don't need to go through the LCS table
+	pre := 0
+	for pre < len(x) && pre < len(y) && x[pre] == y[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(x)-pre && suf < len(y)-pre && x[len(x)-1-suf] == y[len(y)-1-suf] {
+		suf++
+	}
+
+	if n, m := len(x)-pre-suf, len(y)-pre-suf; n > 0 && m > MaxCells/n {
+		return nil, ErrTooLarge
+	}
+
+	var ops []Op
+	ops = appendLines(ops, Equal, x[:pre])
+	ops = appendMiddle(ops, x[pre:len(x)-suf], y[pre:len(y)-suf])
+	ops = appendLines(ops, Equal, x[len(x)-suf:])
+	return ops, nil
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+func appendMiddle(ops []Op, x, y []string) []Op {
+	// lcs[i][j] is the length of LCS of x[i:] & y[j:]
+	lcs := make([][]int32, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			ops = appendLines(ops, Equal, x[i:i+1])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = appendLines(ops, Delete, x[i:i+1])
+			i++
+		default:
+			ops = appendLines(ops, Insert, y[j:j+1])
+			j++
+		}
+	}
+	ops = appendLines(ops, Delete, x[i:])
+	return appendLines(ops, Insert, y[j:])
+}
+
+// appendLines adds lines to the last op if it's of the same type or as a new op
+func appendLines(ops []Op, typ string, lines []string) []Op {
+	if len(lines) == 0 {
+		return ops
+	}
+	text := strings.Join(lines, "\n")
+	if n := len(ops); n > 0 && ops[n-1].Type == typ {
+		ops[n-1].Text += "\n" + text
+		return ops
+	}
+	return append(ops, Op{Type: typ, Text: text})
+}
@@ -0,0 +1,37 @@
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected []Op
+	}{
+		{"a\nb\nc", "a\nb\nc", []Op{{Equal, "a\nb\nc"}}},
+		{"", "a\nb", []Op{{Insert, "a\nb"}}},
+		{"a\nb", "", []Op{{Delete, "a\nb"}}},
+		{"a\nb\nc\nd", "a\nx\nc\nd\ne", []Op{{Equal, "a"}, {Delete, "b"}, {Insert, "x"}, {Equal, "c\nd"}, {Insert, "e"}}},
+		{"a\nb\nc", "c\na", []Op{{Delete, "a\nb"}, {Equal, "c"}, {Insert, "a"}}},
+		{"", "", nil},
+	}
+	for _, c := range cases {
+		if got, err := Lines(c.a, c.b); err != nil || !reflect.DeepEqual(got, c.expected) {
+			t.Fatalf("with %q & %q expected %v, instead we got: %v (%v)", c.a, c.b, c.expected, got, err)
+		}
+	}
+}
+
+func TestLinesTooLarge(t *testing.T) {
+	a, b := strings.Repeat("a\n", 3000), strings.Repeat("b\n", 3000)
+	if _, err := Lines(a, b); err != ErrTooLarge {
+		t.Fatalf("expected texts differing in 3000 lines to be rejected, instead we got: %v", err)
+	}
+	// Lines which are the same at the start & the end aren't counted
+	if _, err := Lines(a+b+a, a+"c"+b+a); err != nil {
+		t.Fatalf("on comparing large texts with a small change: %s", err.Error())
+	}
+}
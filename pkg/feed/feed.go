@@ -0,0 +1,195 @@
+// Package feed encodes lists of posts into RSS 2.0 & Atom documents
+package feed
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Feed describes a syndicated list of entries, links must be absolute
+type Feed struct {
+	Title       string
+	Description string
+	Link        string // the page the feed belongs to
+	Self        string // the feed itself
+	Updated     time.Time
+	Items       []*Item
+}
+
+// Item is an entry of a feed, Content is HTML
+type Item struct {
+	ID         string // a permanent unique identifier of the entry (defaults to Link)
+	Title      string
+	Link       string
+	Author     string
+	Content    string
+	Categories []string
+	Published  time.Time
+	Updated    time.Time
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	NSAtom  string     `xml:"xmlns:atom,attr"`
+	NSDC    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string     `xml:"title"`
+	Link          string     `xml:"link"`
+	Description   string     `xml:"description"`
+	Self          *atomLink  `xml:"atom:link,omitempty"`
+	LastBuildDate string     `xml:"lastBuildDate,omitempty"`
+	Items         []*rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	Creator     string   `xml:"dc:creator,omitempty"`
+	Categories  []string `xml:"category"`
+	PubDate     string   `xml:"pubDate,omitempty"`
+	Description string   `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string       `xml:"id"`
+	Title   string       `xml:"title"`
+	Summary string       `xml:"subtitle,omitempty"`
+	Updated string       `xml:"updated"`
+	Links   []*atomLink  `xml:"link"`
+	Entries []*atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID         string          `xml:"id"`
+	Title      string          `xml:"title"`
+	Link       *atomLink       `xml:"link"`
+	Author     *atomAuthor     `xml:"author,omitempty"`
+	Categories []*atomCategory `xml:"category"`
+	Published  string          `xml:"published,omitempty"`
+	Updated    string          `xml:"updated"`
+	Content    *atomContent    `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// RSS returns f encoded as an RSS 2.0 document
+func (f *Feed) RSS() ([]byte, error) {
+	channel := rssChannel{
+		Title:       f.Title,
+		Link:        f.Link,
+		Description: f.Description,
+		Items:       make([]*rssItem, 0, len(f.Items)),
+	}
+	if f.Self != "" {
+		channel.Self = &atomLink{Href: f.Self, Rel: "self", Type: "application/rss+xml"}
+	}
+	if !f.Updated.IsZero() {
+		channel.LastBuildDate = f.Updated.UTC().Format(time.RFC1123Z)
+	}
+	for _, item := range f.Items {
+		entry := &rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			GUID:        rssGUID{IsPermaLink: item.ID == "", Value: item.id()},
+			Creator:     item.Author,
+			Categories:  item.Categories,
+			Description: item.Content,
+		}
+		if !item.Published.IsZero() {
+			entry.PubDate = item.Published.UTC().Format(time.RFC1123Z)
+		}
+		channel.Items = append(channel.Items, entry)
+	}
+	return encode(&rss{
+		Version: "2.0",
+		NSAtom:  "http://www.w3.org/2005/Atom",
+		NSDC:    "http://purl.org/dc/elements/1.1/",
+		Channel: channel,
+	})
+}
+
+// Atom returns f encoded as an Atom 1.0 document
+func (f *Feed) Atom() ([]byte, error) {
+	feed := &atomFeed{
+		ID:      f.Link,
+		Title:   f.Title,
+		Summary: f.Description,
+		Updated: f.Updated.UTC().Format(time.RFC3339),
+		Links:   []*atomLink{{Href: f.Link, Rel: "alternate", Type: "text/html"}},
+		Entries: make([]*atomEntry, 0, len(f.Items)),
+	}
+	if f.Self != "" {
+		feed.Links = append(feed.Links, &atomLink{Href: f.Self, Rel: "self", Type: "application/atom+xml"})
+	}
+	for _, item := range f.Items {
+		entry := &atomEntry{
+			ID:      item.id(),
+			Title:   item.Title,
+			Link:    &atomLink{Href: item.Link, Rel: "alternate", Type: "text/html"},
+			Updated: item.updated().UTC().Format(time.RFC3339),
+			Content: &atomContent{Type: "html", Value: item.Content},
+		}
+		if item.Author != "" {
+			entry.Author = &atomAuthor{Name: item.Author}
+		}
+		for _, c := range item.Categories {
+			entry.Categories = append(entry.Categories, &atomCategory{Term: c})
+		}
+		if !item.Published.IsZero() {
+			entry.Published = item.Published.UTC().Format(time.RFC3339)
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return encode(feed)
+}
+
+func (item *Item) id() string {
+	if item.ID != "" {
+		return item.ID
+	}
+	return item.Link
+}
+
+// updated returns the time the item was last changed at, Atom requires it for every entry
+func (item *Item) updated() time.Time {
+	if item.Updated.After(item.Published) {
+		return item.Updated
+	}
+	return item.Published
+}
+
+func encode(v interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
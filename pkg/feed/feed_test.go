@@ -0,0 +1,78 @@
+package feed
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestFeed() *Feed {
+	published := time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+	return &Feed{
+		Title:   "Blog",
+		Link:    "http://blog.example/",
+		Updated: published,
+		Items: []*Item{{
+			Title:      "Go & <XML>",
+			Link:       "http://blog.example/post/go",
+			Author:     "alice",
+			Content:    "<p>text</p>",
+			Categories: []string{"go"},
+			Published:  published,
+		}},
+	}
+}
+
+func TestRSS(t *testing.T) {
+	body, err := newTestFeed().RSS()
+	if err != nil {
+		t.Fatalf("on encoding RSS: %s", err.Error())
+	}
+	got := struct {
+		Items []struct {
+			Title       string `xml:"title"`
+			GUID        string `xml:"guid"`
+			PubDate     string `xml:"pubDate"`
+			Description string `xml:"description"`
+		} `xml:"channel>item"`
+	}{}
+	if err := xml.Unmarshal(body, &got); err != nil {
+		t.Fatalf("on decoding RSS: %s", err.Error())
+	}
+	if len(got.Items) != 1 {
+		t.Fatalf("expected 1 item, instead we got: %d", len(got.Items))
+	}
+	item := got.Items[0]
+	if item.Title != "Go & <XML>" || item.Description != "<p>text</p>" ||
+		item.GUID != "http://blog.example/post/go" || item.PubDate != "Wed, 01 Apr 2020 12:00:00 +0000" {
+		t.Fatalf("on getting a wrong item: %+v", item)
+	}
+}
+
+func TestAtom(t *testing.T) {
+	body, err := newTestFeed().Atom()
+	if err != nil {
+		t.Fatalf("on encoding Atom: %s", err.Error())
+	}
+	if !strings.Contains(string(body), `<feed xmlns="http://www.w3.org/2005/Atom">`) {
+		t.Fatalf("on missing the Atom namespace: %s", body)
+	}
+	got := struct {
+		Entries []struct {
+			Updated string `xml:"updated"`
+			Author  string `xml:"author>name"`
+			Content string `xml:"content"`
+		} `xml:"entry"`
+	}{}
+	if err := xml.Unmarshal(body, &got); err != nil {
+		t.Fatalf("on decoding Atom: %s", err.Error())
+	}
+	if len(got.Entries) != 1 {
+		t.Fatalf("expected 1 entry, instead we got: %d", len(got.Entries))
+	}
+	entry := got.Entries[0]
+	if entry.Updated != "2020-04-01T12:00:00Z" || entry.Author != "alice" || entry.Content != "<p>text</p>" {
+		t.Fatalf("on getting a wrong entry: %+v", entry)
+	}
+}
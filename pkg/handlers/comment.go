@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/meddion/web-blog/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const commentsPerPage int64 = 20
+
+// Handlers which do not require user to be authorized
+
+// GetCommentsHandler returns a page (the "page" parameter) of approved comments on the post,
+// replies refer to the comments they answer by parent_id
+func (s *Server) GetCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	post, err := s.posts.GetByID(r.Context(), mux.Vars(r)["id"])
+	if err != nil || !post.IsVisible(time.Now().Unix(), viewerID(r)) {
+		sendErrorResp(w, "on not getting any posts from db", http.StatusNotFound)
+		return
+	}
+	s.sendComments(w, r, models.CommentFilter{PostID: post.ID, Status: models.CommentApproved})
+}
+
+// AddCommentHandler saves a comment on the post, comments of anonymous readers & users whose role doesn't let them
+// skip moderation wait for it; anonymous readers can't take names of registered users
+func (s *Server) AddCommentHandler(w http.ResponseWriter, r *http.Request) {
+	post, err := s.posts.GetByID(r.Context(), mux.Vars(r)["id"])
+	if err != nil || !post.IsVisible(time.Now().Unix(), viewerID(r)) {
+		sendErrorResp(w, "on not getting any posts from db", http.StatusNotFound)
+		return
+	}
+	comment := &models.Comment{}
+	if err := json.NewDecoder(r.Body).Decode(comment); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	comment.PostID = post.ID
+	comment.UserID = primitive.NilObjectID
+	comment.Status = models.CommentPending
+	if user, err := GetUserFromSession(r); err == nil {
+		comment.UserID = user.ID
+		comment.AuthorName = user.Name
+		if user.Can(models.PermSkipModeration) {
+			comment.Status = models.CommentApproved
+		}
+	}
+	if err := comment.Validate(); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if comment.UserID.IsZero() {
+		if _, err := s.users.GetByName(r.Context(), comment.AuthorName); err == nil {
+			sendErrorResp(w, "on receiving a commenter name which belongs to a registered user", http.StatusBadRequest)
+			return
+		} else if err != models.ErrNotFound {
+			sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if !comment.ParentID.IsZero() {
+		parent, err := s.comments.GetByID(r.Context(), comment.ParentID.Hex())
+		if err != nil || parent.PostID != post.ID || parent.Status != models.CommentApproved {
+			sendErrorResp(w, "on replying to a comment which doesn't exist", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := s.comments.Create(r.Context(), comment); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sendSuccessResp(w, map[string]interface{}{"id": comment.ID, "status": comment.Status})
+}
+
+// Require authorization
+
+// GetCommentsQueueHandler returns a page of comments with the given status ("pending" by default)
+// on all the posts for moderators
+func (s *Server) GetCommentsQueueHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.CommentPending
+	}
+	if err := models.ValidateCommentStatus(status); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.sendComments(w, r, models.CommentFilter{Status: status})
+}
+
+// ModerateCommentHandler sets the status of a comment: {"status": "approved" | "pending" | "spam"}
+func (s *Server) ModerateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment, err := s.comments.GetByID(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		sendErrorResp(w, "on not getting the comment from db", http.StatusNotFound)
+		return
+	}
+	body := struct {
+		Status string `json:"status"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := models.ValidateCommentStatus(body.Status); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.comments.SetStatus(r.Context(), comment.ID, body.Status); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sendSuccessResp(w, nil)
+}
+
+// DeleteCommentHandler removes a comment along with the replies to it
+func (s *Server) DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment, err := s.comments.GetByID(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		sendErrorResp(w, "on not getting the comment from db", http.StatusNotFound)
+		return
+	}
+	if err := s.comments.DeleteByID(r.Context(), comment.ID); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sendSuccessResp(w, nil)
+}
+
+// sendComments sends a page of comments passing filter, the page is chosen by the "page" parameter
+func (s *Server) sendComments(w http.ResponseWriter, r *http.Request, filter models.CommentFilter) {
+	pageNum, err := strconv.ParseInt(r.URL.Query().Get("page"), 10, 64)
+	if err != nil || pageNum < 1 {
+		pageNum = 1
+	}
+	total, err := s.comments.Count(r.Context(), filter)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	comments, err := s.comments.List(r.Context(), models.CommentsQuery{
+		Filter:   filter,
+		PageSize: commentsPerPage,
+		PageNum:  pageNum,
+	})
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sendSuccessResp(w, map[string]interface{}{
+		"totalNumOfComments": total,
+		"commentsPerPage":    commentsPerPage,
+		"comments":           comments,
+	})
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/meddion/web-blog/pkg/models"
+	"github.com/meddion/web-blog/pkg/models/memory"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAddCommentHandler(t *testing.T) {
+	stores := memory.NewStores()
+	srv := NewServer(stores, Options{})
+	post := &models.Post{Title: "title", Content: "content", Status: models.StatusPublished, PublishedAt: 1}
+	stores.Posts.Save(context.TODO(), post)
+	registered := &models.User{Name: "bob", Password: "hash", Role: models.RoleReader}
+	if err := stores.Users.Create(context.TODO(), registered); err != nil {
+		t.Fatalf("on creating a user: %s", err.Error())
+	}
+
+	cases := []struct {
+		user   *models.User
+		name   string
+		code   int
+		status string
+	}{
+		{nil, "alice", http.StatusAccepted, models.CommentPending},
+		{nil, "bob", http.StatusBadRequest, ""}, // taken by a registered user
+		{registered, "", http.StatusAccepted, models.CommentPending},
+		{&models.User{ID: primitive.NewObjectID(), Name: "carol", Role: models.RoleAuthor}, "", http.StatusAccepted, models.CommentApproved},
+		{&models.User{ID: primitive.NewObjectID(), Name: "dave", Role: models.RoleEditor}, "", http.StatusAccepted, models.CommentApproved},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("POST", "/api/posts/id/comments", strings.NewReader(`{"author_name":"`+c.name+`","content":"hi"}`))
+		if c.user != nil {
+			r = withUser(r, c.user)
+		}
+		r = mux.SetURLVars(r, map[string]string{"id": post.ID.Hex()})
+		rec := httptest.NewRecorder()
+		srv.AddCommentHandler(rec, r)
+		if rec.Code != c.code {
+			t.Fatalf("on commenting as %q expected code %d, instead we got: %d (%s)", c.name, c.code, rec.Code, rec.Body.String())
+		}
+		if c.code != http.StatusAccepted {
+			continue
+		}
+		var body struct{ Status string }
+		decodeResp(t, rec, &body)
+		if body.Status != c.status {
+			t.Fatalf("on commenting as %v expected the comment to be %q, instead we got: %q", c.user, c.status, body.Status)
+		}
+	}
+}
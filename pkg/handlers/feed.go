@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/feed"
+	"github.com/meddion/web-blog/pkg/models"
+)
+
+const (
+	postsPerFeed    int64 = 20
+	feedTitle             = "Blog"
+	feedDescription       = "The latest posts"
+)
+
+// Handlers which do not require user to be authorized,
+// feeds of the latest published posts can be narrowed down to a tag by the "tag" parameter
+
+func (s *Server) RSSFeedHandler(w http.ResponseWriter, r *http.Request) {
+	s.sendFeed(w, r, "application/rss+xml; charset=utf-8", (*feed.Feed).RSS)
+}
+
+func (s *Server) AtomFeedHandler(w http.ResponseWriter, r *http.Request) {
+	s.sendFeed(w, r, "application/atom+xml; charset=utf-8", (*feed.Feed).Atom)
+}
+
+// sendFeed writes the feed encoded by encode, conditional requests are answered
+// with 304 based on ETag & Last-Modified headers
+func (s *Server) sendFeed(w http.ResponseWriter, r *http.Request, contentType string, encode func(*feed.Feed) ([]byte, error)) {
+	f, err := s.buildFeed(r)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body, err := encode(f)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sum := sha1.Sum(body)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	w.Header().Set("Content-Type", contentType)
+	http.ServeContent(w, r, "", f.Updated, bytes.NewReader(body))
+}
+
+func (s *Server) buildFeed(r *http.Request) (*feed.Feed, error) {
+	// Feeds are the same for everyone, so there are no drafts of a logged-in author
+	filter := models.CreatePostFilter(r)
+	filter.VisibleAt = time.Now().Unix()
+	posts, err := s.posts.List(r.Context(), models.PostsQuery{Filter: filter, PageSize: postsPerFeed, PageNum: 1})
+	if err != nil {
+		return nil, err
+	}
+
+	f := &feed.Feed{
+		Title:       feedTitle,
+		Description: feedDescription,
+		Link:        s.opts.Domain + "/",
+		Self:        requestURL(r),
+		Items:       make([]*feed.Item, 0, len(posts)),
+	}
+	if filter.Tag != "" {
+		f.Title += ": " + filter.Tag
+		f.Description += " tagged " + filter.Tag
+	}
+	for _, p := range posts {
+		renderLegacy(&p.Post)
+		item := &feed.Item{
+			ID:         s.opts.Domain + "/post/" + p.ID.Hex(),
+			Title:      p.Title,
+			Link:       s.postURL(&p.Post),
+			Author:     p.Author.Name,
+			Content:    p.ContentHTML,
+			Categories: p.Tags,
+			Published:  time.Unix(p.PublicationTime(), 0),
+			Updated:    time.Unix(p.LastEdited, 0),
+		}
+		f.Items = append(f.Items, item)
+		for _, t := range []time.Time{item.Published, item.Updated} {
+			if t.After(f.Updated) {
+				f.Updated = t
+			}
+		}
+	}
+	return f, nil
+}
+
+// postURL returns the absolute link to the post on the client
+func (s *Server) postURL(p *models.Post) string {
+	if p.Slug == "" {
+		return s.opts.Domain + "/post/" + p.ID.Hex()
+	}
+	return s.opts.Domain + "/post/" + url.PathEscape(p.Slug)
+}
+
+// requestURL returns the absolute URL the client requested
+func requestURL(r *http.Request) string {
+	return requestBase(r) + r.URL.RequestURI()
+}
+
+// requestBase returns the scheme & host the client made the request to
+func requestBase(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/meddion/web-blog/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// All of the handlers require authorization & are available to admins
+
+// CreateInviteHandler makes an invite: {"role": "author", "max_uses": 1, "expires_in": <seconds>},
+// the token is returned only once & has to be passed to the signup endpoint
+func (s *Server) CreateInviteHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := GetUserFromSession(r)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body := struct {
+		Role      string `json:"role"`
+		MaxUses   int64  `json:"max_uses"`
+		ExpiresIn int64  `json:"expires_in"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendErrorResp(w, "on decoding a request body", http.StatusBadRequest)
+		return
+	}
+	invite, token, err := models.NewInvite(body.Role, body.MaxUses, time.Duration(body.ExpiresIn)*time.Second)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	invite.CreatedBy = user.ID
+	if err := s.invites.Create(r.Context(), invite); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sendSuccessResp(w, map[string]interface{}{"invite": invite, "token": token})
+}
+
+func (s *Server) GetInvitesHandler(w http.ResponseWriter, r *http.Request) {
+	invites, err := s.invites.List(r.Context())
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sendSuccessResp(w, invites)
+}
+
+// RevokeInviteHandler deletes an invite, so it can't be used anymore
+func (s *Server) RevokeInviteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.invites.DeleteByID(r.Context(), id); err == models.ErrNotFound {
+		sendErrorResp(w, "on founding the invite", http.StatusNotFound)
+		return
+	} else if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sendSuccessResp(w, nil)
+}
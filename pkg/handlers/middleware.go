@@ -2,15 +2,23 @@ package handlers
 
 import (
 	"context"
+	"encoding/gob"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/meddion/web-blog/pkg/models"
 	"github.com/meddion/web-blog/pkg/session"
-	_ "github.com/meddion/web-blog/pkg/session/providers/memory"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+func init() {
+	// Types of the values put into sessions, providers persisting sessions encode them with gob
+	gob.Register(primitive.ObjectID{})
+}
+
 // CORSMiddleware provides Cross-Origin Resource Sharing middleware.
 // based on gorilla/handlers implementation
 func CORSMiddleware(originAllowed string) func(http.Handler) http.Handler {
@@ -20,7 +28,7 @@ func CORSMiddleware(originAllowed string) func(http.Handler) http.Handler {
 			w.Header().Add("Access-Control-Allow-Origin", originAllowed)
 			w.Header().Add("Access-Control-Allow-Credentials", "true")
 			w.Header().Add("Access-Control-Allow-Methods", "GET, POST, DELETE, PUT, OPTIONS")
-			w.Header().Add("Access-Control-Allow-Headers", "Content-Type, Accept-Encoding")
+			w.Header().Add("Access-Control-Allow-Headers", "Content-Type, Accept-Encoding, Authorization")
 			if r.Method == "OPTIONS" {
 				return
 			}
@@ -30,23 +38,23 @@ func CORSMiddleware(originAllowed string) func(http.Handler) http.Handler {
 }
 
 type sessionAuthMiddleware struct {
-	notAuth map[string]struct{}
-	manager *session.Manager
+	notAuth   map[string]struct{}
+	required  map[string]models.Permission // "METHOD /path/template" -> permission
+	streaming map[string]struct{}          // "METHOD /path/template"
+	manager   *session.Manager
+	users     models.UserStore
+	tokens    models.APITokenStore
 }
 
-func NewSessionAuthMiddleware(notAuthURLs ...string) (*sessionAuthMiddleware, error) {
-	m := &sessionAuthMiddleware{}
+func NewSessionAuthMiddleware(manager *session.Manager, users models.UserStore, tokens models.APITokenStore, notAuthURLs ...string) *sessionAuthMiddleware {
+	m := &sessionAuthMiddleware{manager: manager, users: users, tokens: tokens}
+	m.required = make(map[string]models.Permission)
+	m.streaming = make(map[string]struct{})
 	m.notAuth = make(map[string]struct{})
 	for _, val := range notAuthURLs {
 		m.notAuth[val] = struct{}{}
 	}
-	var err error
-	m.manager, err = session.NewManager("memory", "SESSION_ID", 30*3600) // 30 min
-	if err != nil {
-		return nil, fmt.Errorf("on initializing globalSessionManager: %s", err.Error())
-	}
-	go m.manager.GC()
-	return m, nil
+	return m
 }
 
 func (m *sessionAuthMiddleware) Middleware(next http.Handler) http.Handler {
@@ -61,35 +69,139 @@ func (m *sessionAuthMiddleware) Middleware(next http.Handler) http.Handler {
 			sendErrorResp(w, "on getting the path template from the route", http.StatusInternalServerError)
 			return
 		}
-		// Creating a new session.
-		session, err := m.manager.SessionStart(w, r)
+		// Setting timeout for database operations
+		base := r.Context()
+		ctxWithTimeout, cancelFunc := context.WithTimeout(base, 3*time.Second)
+		defer cancelFunc()
+		r = r.WithContext(ctxWithTimeout)
+
+		// Scripts pass an API token instead of the session cookie,
+		// their sessions last for the request only
+		var (
+			session session.Session
+			user    *models.User
+			token   *models.APIToken
+		)
+		if bearer, ok := bearerToken(r); ok {
+			session = newRequestSession()
+			token, user, err = m.authenticateToken(r.Context(), bearer)
+			if err == models.ErrNotFound {
+				sendErrorResp(w, "on matching the API token", http.StatusUnauthorized)
+				return
+			}
+			if err == nil {
+				err = session.Set("USER_ID", user.ID)
+			}
+		} else {
+			// Creating a new session.
+			session, err = m.manager.SessionStart(w, r)
+			if err != nil {
+				sendErrorResp(w, "on starting a session for a client", http.StatusInternalServerError)
+				return
+			}
+			// Sessions keep the ID of the logged-in user only, the account is loaded on every request
+			user, err = m.loadUser(r.Context(), session)
+		}
 		if err != nil {
-			sendErrorResp(w, "on starting a session for a client", http.StatusInternalServerError)
+			sendErrorResp(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		switch path {
-		case "/api/account/logout":
-			r = r.WithContext(context.WithValue(r.Context(), "manager", m.manager))
-		default:
-			r = r.WithContext(context.WithValue(r.Context(), "session", session))
+		// Handlers streaming files aren't limited by the timeout, they limit the time between transfers of chunks
+		ctx := r.Context()
+		if _, ok := m.streaming[r.Method+" "+path]; ok {
+			ctx = base
 		}
-		// Setting timeout for database operations
-		ctxWithTimeout, cancelFunc := context.WithTimeout(r.Context(), 3*time.Second)
-		defer cancelFunc()
-		r = r.WithContext(ctxWithTimeout)
+		ctx = context.WithValue(ctx, "manager", m.manager)
+		ctx = context.WithValue(ctx, "session", session)
+		if user != nil {
+			ctx = context.WithValue(ctx, "user", user)
+		}
+		r = r.WithContext(ctx)
 
-		// Iterating through URI-paths which do not require an authentication from a user
-		if _, ok := m.notAuth[path]; ok {
+		// Iterating through URI-paths which do not require an authentication from a user,
+		// the methods of them which require a permission (e.g. uploading files) still do
+		perm, ok := m.required[r.Method+" "+path]
+		if _, public := m.notAuth[path]; public && !ok {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		// Sending 401 code if a user is not unauthorized
-		if !session.IsValuePresent("USER") {
+		// Sending 401 code if a user is not unauthorized,
+		// half-authenticated sessions (awaiting the second factor) have no "USER_ID" as well
+		if user == nil {
 			sendErrorResp(w, "", http.StatusUnauthorized)
 			return
 		}
+		// Sending 403 code if the user's role doesn't allow the action
+		if ok && !user.Can(perm) {
+			sendErrorResp(w, fmt.Sprintf("on lacking the permission to %s", perm), http.StatusForbidden)
+			return
+		}
+		// API tokens are limited to the actions of their scopes,
+		// so they can't be used to manage the account
+		if token != nil && (!ok || !token.Allows(perm)) {
+			sendErrorResp(w, "on using an API token out of its scopes", http.StatusForbidden)
+			return
+		}
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// authenticateToken returns the API token matching bearer along with its owner,
+// ErrNotFound is returned if there is no such token or it has expired
+func (m *sessionAuthMiddleware) authenticateToken(ctx context.Context, bearer string) (*models.APIToken, *models.User, error) {
+	token, err := m.tokens.Use(ctx, models.HashToken(bearer), time.Now().Unix())
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := m.users.GetByID(ctx, token.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return token, user, nil
+}
+
+// bearerToken returns the token passed in "Authorization: Bearer <token>" header
+func bearerToken(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < len("Bearer ") || !strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(auth[len("Bearer "):]), true
+}
+
+// loadUser returns the account logged in the session, so secrets of it (e.g. the password hash)
+// never get into sessions; the user is logged out (nil is returned)
+// if the account was deleted or its sessions were revoked
+func (m *sessionAuthMiddleware) loadUser(ctx context.Context, s session.Session) (*models.User, error) {
+	id, ok := s.Get("USER_ID").(primitive.ObjectID)
+	if !ok {
+		return nil, nil
+	}
+	user, err := m.users.GetByID(ctx, id)
+	if err != nil && err != models.ErrNotFound {
+		return nil, err
+	}
+	authTime, _ := s.Get("AUTH_TIME").(int64)
+	if err == models.ErrNotFound || authTime < user.SessionsValidFrom {
+		s.Delete("USER_ID")
+		s.Delete("AUTH_TIME")
+		return nil, nil
+	}
+	return user, nil
+}
+
+// Stream exempts routes (given as "METHOD /path/template") from the timeout of database operations
+func (m *sessionAuthMiddleware) Stream(routes ...string) {
+	for _, route := range routes {
+		m.streaming[route] = struct{}{}
+	}
+}
+
+// Require allows routes (given as "METHOD /path/template") only to users having perm
+func (m *sessionAuthMiddleware) Require(perm models.Permission, routes ...string) {
+	for _, route := range routes {
+		m.required[route] = perm
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/models"
+	"github.com/meddion/web-blog/pkg/models/memory"
+)
+
+func TestLoadUser(t *testing.T) {
+	stores := memory.NewStores()
+	user := &models.User{Name: "alice", Password: "hash"}
+	if err := stores.Users.Create(context.TODO(), user); err != nil {
+		t.Fatalf("on creating a user: %s", err.Error())
+	}
+	srv := NewServer(stores, Options{})
+	m := NewSessionAuthMiddleware(nil, stores.Users, stores.Tokens)
+
+	// Sessions keep the ID of the user only, not the account along with its secrets
+	session := newRequestSession()
+	if err := srv.logIn(httptest.NewRequest("POST", "/api/account/login", nil), session, user); err != nil {
+		t.Fatalf("on logging in: %s", err.Error())
+	}
+	for _, key := range session.Keys() {
+		if key != "USER_ID" && key != "AUTH_TIME" {
+			t.Fatalf("expected only the ID of the user & the time of logging in to be kept, instead we got: %v", session.Keys())
+		}
+	}
+	got, err := m.loadUser(context.TODO(), session)
+	if err != nil || got == nil || got.Name != "alice" {
+		t.Fatalf("expected the logged-in user to be loaded, instead we got: %v (%v)", got, err)
+	}
+
+	// Revoking the sessions of the user logs the session out
+	stores.Users.Update(context.TODO(), &models.User{ID: user.ID, SessionsValidFrom: time.Now().UnixNano()})
+	if got, err := m.loadUser(context.TODO(), session); err != nil || got != nil || session.IsValuePresent("USER_ID") {
+		t.Fatalf("expected a revoked session to be logged out, instead we got: %v (%v)", got, err)
+	}
+}
@@ -2,19 +2,26 @@ package handlers
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/meddion/web-blog/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 const postsPerPage int64 = 10
 
+// maxSlugAttempts is how many times a post is saved when concurrent posts take its slug
+const maxSlugAttempts = 5
+
 // Handlers which do not require user to be authorized
 
-func GetPostsInfoHandler(w http.ResponseWriter, r *http.Request) {
-	totalNumOfPosts, err := models.GetTotalNumOfPosts(r.Context(), nil)
+func (s *Server) GetPostsInfoHandler(w http.ResponseWriter, r *http.Request) {
+	totalNumOfPosts, err := s.posts.Count(r.Context(), visibleTo(r, models.CreatePostFilter(r)))
 	if err != nil {
 		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -25,7 +32,7 @@ func GetPostsInfoHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func GetPostsHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetPostsHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	pageNum, err := strconv.ParseInt(vars["pageNum"], 10, 64)
 	if err != nil {
@@ -35,10 +42,9 @@ func GetPostsHandler(w http.ResponseWriter, r *http.Request) {
 	if pageNum < 1 {
 		pageNum = 1
 	}
-	posts, err := models.GetPosts(
-		r.Context(),
-		models.CreatePostsPipeline(r, postsPerPage, pageNum),
-	)
+	query := models.CreatePostsQuery(r, postsPerPage, pageNum)
+	query.Filter = visibleTo(r, query.Filter)
+	posts, err := s.posts.List(r.Context(), query)
 	if err != nil {
 		sendErrorResp(w, err.Error(), http.StatusBadRequest)
 		return
@@ -47,22 +53,51 @@ func GetPostsHandler(w http.ResponseWriter, r *http.Request) {
 		sendErrorResp(w, "nothing was found", http.StatusBadRequest)
 		return
 	}
+	for _, p := range posts {
+		renderLegacy(&p.Post)
+	}
 	sendSuccessResp(w, posts)
 }
 
-func GetPostHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetPostHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	post, err := models.GetPostByID(r.Context(), vars["id"])
-	if err != nil {
+	post, err := s.posts.GetByID(r.Context(), vars["id"])
+	if err != nil || !post.IsVisible(time.Now().Unix(), viewerID(r)) {
 		sendErrorResp(w, "on not getting any posts from db", http.StatusBadRequest)
 		return
 	}
+	renderLegacy(post)
+	sendSuccessResp(w, post)
+}
+
+func (s *Server) GetTagsHandler(w http.ResponseWriter, r *http.Request) {
+	tags, err := s.posts.Tags(r.Context(), visibleTo(r, models.PostFilter{}))
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sendSuccessResp(w, tags)
+}
+
+func (s *Server) GetPostBySlugHandler(w http.ResponseWriter, r *http.Request) {
+	slug := mux.Vars(r)["slug"]
+	post, err := s.posts.GetBySlug(r.Context(), slug)
+	if err != nil || !post.IsVisible(time.Now().Unix(), viewerID(r)) {
+		sendErrorResp(w, "on not getting any posts from db", http.StatusNotFound)
+		return
+	}
+	// Old slugs redirect to the current one
+	if post.Slug != slug {
+		sendRedirectResp(w, "/api/post/by-slug/"+url.PathEscape(post.Slug), map[string]string{"slug": post.Slug})
+		return
+	}
+	renderLegacy(post)
 	sendSuccessResp(w, post)
 }
 
 // Require authorization
 
-func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 	post := &models.Post{}
 	if err := json.NewDecoder(r.Body).Decode(post); err != nil {
 		sendErrorResp(w, err.Error(), http.StatusBadRequest)
@@ -73,32 +108,185 @@ func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	post.AuthorID = user.ID
-	if err := post.Save(r.Context()); err != nil {
+	if err := post.ValidateTags(); err != nil {
 		sendErrorResp(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	sendSuccessResp(w, map[string]interface{}{"id": post.ID})
+	if err := post.ValidateStatus(nil); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := post.RenderContent(); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	post.AuthorID = user.ID
+	post.EditorID = user.ID
+	// A concurrent post may take the slug after it's checked, then the next free one is tried
+	requested := post.Slug
+	for attempt := 1; ; attempt++ {
+		post.Slug = requested
+		if !s.validateSlug(w, r, post, nil) {
+			return
+		}
+		err := s.posts.Save(r.Context(), post)
+		if err == models.ErrSlugTaken && attempt < maxSlugAttempts {
+			continue
+		}
+		if err != nil {
+			sendErrorResp(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		break
+	}
+	sendSuccessResp(w, map[string]interface{}{"id": post.ID, "slug": post.Slug})
 }
 
-func UpdatePostHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) UpdatePostHandler(w http.ResponseWriter, r *http.Request) {
 	post := &models.Post{}
 	if err := json.NewDecoder(r.Body).Decode(post); err != nil {
 		sendErrorResp(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if err := post.Update(r.Context()); err != nil {
+	if err := post.ValidateTags(); err != nil {
 		sendErrorResp(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	sendSuccessResp(w, nil)
+	prev, err := s.posts.GetByID(r.Context(), post.ID.Hex())
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	user, err := GetUserFromSession(r)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !user.CanEditPost(prev) {
+		sendErrorResp(w, errEditForbidden, http.StatusForbidden)
+		return
+	}
+	if err := post.ValidateStatus(prev); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	requested := post.Slug
+	if !s.validateSlug(w, r, post, prev) {
+		return
+	}
+	if err := post.RenderContent(); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The author & the creation time can't be changed by editing
+	post.AuthorID = prev.AuthorID
+	post.CreationTime = prev.CreationTime
+	post.EditorID = user.ID
+	// Keeping the previous version if it's going to be changed
+	if prev.Title != post.Title || prev.Content != post.Content {
+		if err := s.revisions.Add(r.Context(), models.NewRevision(prev)); err != nil {
+			sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	for attempt := 1; ; attempt++ {
+		err := s.posts.Update(r.Context(), post)
+		if err == models.ErrSlugTaken && attempt < maxSlugAttempts {
+			// Taken by a concurrent post after it was checked
+			post.Slug = requested
+			if !s.validateSlug(w, r, post, prev) {
+				return
+			}
+			continue
+		}
+		if err != nil {
+			sendErrorResp(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		break
+	}
+	sendSuccessResp(w, map[string]interface{}{"slug": post.Slug})
 }
 
-func DeletePostHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	if err := models.DeletePostById(r.Context(), vars["id"]); err != nil {
+func (s *Server) DeletePostHandler(w http.ResponseWriter, r *http.Request) {
+	post := s.getEditablePost(w, r)
+	if post == nil {
+		return
+	}
+	if err := s.posts.DeleteByID(r.Context(), post.ID.Hex()); err != nil {
 		sendErrorResp(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err := s.revisions.DeleteByPost(r.Context(), post.ID); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.comments.DeleteByPost(r.Context(), post.ID); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	sendSuccessResp(w, nil)
 }
+
+// errEditForbidden is sent to users changing posts which their role doesn't allow them to
+// validateSlug sets a unique slug of post (see models.Post.ValidateSlug),
+// 400 code is sent if the requested slug is taken, 500 code on other errors
+func (s *Server) validateSlug(w http.ResponseWriter, r *http.Request, post, prev *models.Post) bool {
+	err := post.ValidateSlug(r.Context(), s.posts, prev)
+	if err == models.ErrSlugTaken {
+		sendErrorResp(w, err.Error(), http.StatusBadRequest)
+		return false
+	} else if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+const errEditForbidden = "on lacking the permission to change posts of other authors"
+
+// getEditablePost returns the post with the "id" route variable if the user is allowed to change it,
+// otherwise an error response is sent & nil is returned
+func (s *Server) getEditablePost(w http.ResponseWriter, r *http.Request) *models.Post {
+	user, err := GetUserFromSession(r)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	post, err := s.posts.GetByID(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		sendErrorResp(w, "on not getting any posts from db", http.StatusNotFound)
+		return nil
+	}
+	if !user.CanEditPost(post) {
+		sendErrorResp(w, errEditForbidden, http.StatusForbidden)
+		return nil
+	}
+	return post
+}
+
+// renderLegacy renders content of posts saved before it was rendered on saving
+func renderLegacy(p *models.Post) {
+	if p.ContentHTML == "" && p.Content != "" {
+		if err := p.RenderContent(); err != nil {
+			log.Printf("on rendering content of the post %s: %s", p.ID.Hex(), err.Error())
+		}
+	}
+}
+
+// viewerID returns the ID of a logged-in user or zero for anonymous readers
+func viewerID(r *http.Request) primitive.ObjectID {
+	user, err := GetUserFromSession(r)
+	if err != nil {
+		return primitive.NilObjectID
+	}
+	return user.ID
+}
+
+// visibleTo limits filter to the posts which can be seen by the client right now:
+// published ones & client's own posts
+func visibleTo(r *http.Request, filter models.PostFilter) models.PostFilter {
+	filter.VisibleAt = time.Now().Unix()
+	filter.ViewerID = viewerID(r)
+	return filter
+}
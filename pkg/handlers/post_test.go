@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/meddion/web-blog/pkg/models"
+	"github.com/meddion/web-blog/pkg/models/memory"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakePostStore keeps posts in a map, methods which aren't overridden panic
+type fakePostStore struct {
+	models.PostStore
+	posts map[string]*models.Post
+}
+
+func (f *fakePostStore) Save(ctx context.Context, p *models.Post) error {
+	p.ID = primitive.NewObjectID()
+	f.posts[p.ID.Hex()] = p
+	return nil
+}
+
+func (f *fakePostStore) Update(ctx context.Context, p *models.Post) error {
+	if _, ok := f.posts[p.ID.Hex()]; !ok {
+		return models.ErrNotFound
+	}
+	f.posts[p.ID.Hex()] = p
+	return nil
+}
+
+func (f *fakePostStore) DeleteByID(ctx context.Context, id string) error {
+	if _, ok := f.posts[id]; !ok {
+		return models.ErrNotFound
+	}
+	delete(f.posts, id)
+	return nil
+}
+
+func (f *fakePostStore) GetByID(ctx context.Context, id string) (*models.Post, error) {
+	if p, ok := f.posts[id]; ok {
+		return p, nil
+	}
+	return nil, models.ErrNotFound
+}
+
+func (f *fakePostStore) Count(ctx context.Context, filter models.PostFilter) (int64, error) {
+	return int64(len(f.posts)), nil
+}
+
+func (f *fakePostStore) List(ctx context.Context, q models.PostsQuery) ([]*models.PostWithAuthor, error) {
+	var posts []*models.PostWithAuthor
+	for _, p := range f.posts {
+		posts = append(posts, &models.PostWithAuthor{Post: *p})
+	}
+	return posts, nil
+}
+
+func newFakeServer() (*Server, *fakePostStore) {
+	posts := &fakePostStore{posts: make(map[string]*models.Post)}
+	return NewServer(&models.Stores{Posts: posts}, Options{Domain: "http://blog.example"}), posts
+}
+
+func decodeResp(t *testing.T, rec *httptest.ResponseRecorder, body interface{}) response {
+	resp := response{Body: body}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("on decoding a response: %s", err.Error())
+	}
+	return resp
+}
+
+func TestGetPostHandler(t *testing.T) {
+	srv, posts := newFakeServer()
+	post := &models.Post{Title: "title", Content: "content"}
+	posts.Save(context.TODO(), post)
+
+	cases := []struct {
+		id   string
+		code int
+	}{
+		{post.ID.Hex(), http.StatusAccepted},
+		{primitive.NewObjectID().Hex(), http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		r := mux.SetURLVars(httptest.NewRequest("GET", "/api/post/"+c.id, nil), map[string]string{"id": c.id})
+		rec := httptest.NewRecorder()
+		srv.GetPostHandler(rec, r)
+		if rec.Code != c.code {
+			t.Fatalf("on getting the post %s expected code %d, instead we got: %d", c.id, c.code, rec.Code)
+		}
+		if c.code != http.StatusAccepted {
+			continue
+		}
+		got := &models.Post{}
+		decodeResp(t, rec, got)
+		if got.Title != post.Title || got.ID != post.ID {
+			t.Fatalf("expected the post %v, instead we got: %v", post, got)
+		}
+	}
+}
+
+func TestGetPostsInfoHandler(t *testing.T) {
+	srv, posts := newFakeServer()
+	for i := 0; i < 3; i++ {
+		posts.Save(context.TODO(), &models.Post{Title: "title"})
+	}
+	rec := httptest.NewRecorder()
+	srv.GetPostsInfoHandler(rec, httptest.NewRequest("GET", "/api/posts/info", nil))
+
+	info := map[string]int64{}
+	if resp := decodeResp(t, rec, &info); !resp.Ok {
+		t.Fatalf("on getting posts info: %s", resp.Err)
+	}
+	if info["totalNumOfPosts"] != 3 || info["postsPerPage"] != postsPerPage {
+		t.Fatalf("on getting wrong posts info: %v", info)
+	}
+}
+
+// withUser returns r made by user logged in, as the middleware does
+func withUser(r *http.Request, user *models.User) *http.Request {
+	session := newRequestSession()
+	session.Set("USER_ID", user.ID)
+	ctx := context.WithValue(r.Context(), "session", session)
+	return r.WithContext(context.WithValue(ctx, "user", user))
+}
+
+func TestUpdatePostHandler(t *testing.T) {
+	stores := memory.NewStores()
+	srv := NewServer(stores, Options{Domain: "http://blog.example"})
+	author := &models.User{ID: primitive.NewObjectID(), Role: models.RoleAuthor}
+	post := &models.Post{Title: "title", Content: "content", AuthorID: author.ID, Status: models.StatusDraft}
+	stores.Posts.Save(context.TODO(), post)
+	created := post.CreationTime
+
+	// The author & the creation time sent by a client are ignored
+	body := fmt.Sprintf(`{"id":%q,"title":"new title","content":"content","author_id":%q,"creation_time":1}`,
+		post.ID.Hex(), primitive.NewObjectID().Hex())
+	rec := httptest.NewRecorder()
+	srv.UpdatePostHandler(rec, withUser(httptest.NewRequest("PUT", "/api/post/", strings.NewReader(body)), author))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("on updating the post expected code %d, instead we got: %d (%s)", http.StatusAccepted, rec.Code, rec.Body.String())
+	}
+	got, err := stores.Posts.GetByID(context.TODO(), post.ID.Hex())
+	if err != nil {
+		t.Fatalf("on getting the updated post: %s", err.Error())
+	}
+	if got.Title != "new title" || got.AuthorID != author.ID || got.CreationTime != created || got.Status != models.StatusDraft {
+		t.Fatalf("expected only the title to be changed, instead we got: %+v", got)
+	}
+}
+
+// staleSlugStore misses the slugs taken when they are checked the first time, like a concurrent post taking them
+type staleSlugStore struct {
+	models.PostStore
+	checked bool
+}
+
+func (s *staleSlugStore) SlugTaken(ctx context.Context, slug string, exceptID primitive.ObjectID) (bool, error) {
+	if !s.checked {
+		s.checked = true
+		return false, nil
+	}
+	return s.PostStore.SlugTaken(ctx, slug, exceptID)
+}
+
+func TestCreatePostHandlerSlugs(t *testing.T) {
+	stores := memory.NewStores()
+	stores.Posts.Save(context.TODO(), &models.Post{Title: "title", Slug: "title"})
+	stores.Posts = &staleSlugStore{PostStore: stores.Posts}
+	srv := NewServer(stores, Options{Domain: "http://blog.example"})
+	author := &models.User{ID: primitive.NewObjectID(), Role: models.RoleAuthor}
+
+	create := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.CreatePostHandler(rec, withUser(httptest.NewRequest("POST", "/api/post/", strings.NewReader(body)), author))
+		return rec
+	}
+	rec := create(`{"title":"title","content":"content"}`)
+	created := struct {
+		Slug string `json:"slug"`
+	}{}
+	if resp := decodeResp(t, rec, &created); rec.Code != http.StatusAccepted || created.Slug != "title-2" {
+		t.Fatalf("expected the post to get the next free slug, instead we got: %d %v (%s)", rec.Code, created.Slug, resp.Err)
+	}
+
+	// Updating a post with a slug which is taken is a bad request
+	post, err := stores.Posts.GetBySlug(context.TODO(), "title-2")
+	if err != nil {
+		t.Fatalf("on getting the created post: %s", err.Error())
+	}
+	rec = httptest.NewRecorder()
+	body := fmt.Sprintf(`{"id":%q,"title":"title","content":"content","slug":"title"}`, post.ID.Hex())
+	srv.UpdatePostHandler(rec, withUser(httptest.NewRequest("PUT", "/api/post/", strings.NewReader(body)), author))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("on taking the slug of another post expected code %d, instead we got: %d", http.StatusBadRequest, rec.Code)
+	}
+}
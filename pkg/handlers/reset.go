@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/mail"
+	"github.com/meddion/web-blog/pkg/models"
+)
+
+// Handlers which do not require user to be authorized
+
+// RequestPasswordResetHandler emails a link to reset the password of the account with the given email:
+// {"email": "..."}, the response is the same whether there is such account or not
+func (s *Server) RequestPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		Email string `json:"email"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendErrorResp(w, "on decoding a request body", http.StatusBadRequest)
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(body.Email))
+	if email == "" {
+		sendSuccessResp(w, nil)
+		return
+	}
+	user, err := s.users.GetByEmail(r.Context(), email)
+	if err == models.ErrNotFound {
+		sendSuccessResp(w, nil)
+		return
+	} else if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	reset, token, err := models.NewPasswordReset(user.ID)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.resets.Create(r.Context(), reset); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	msg := &mail.Message{
+		To:      user.Email,
+		Subject: "Resetting your password",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"To set a new password follow the link within an hour:\n" +
+			s.opts.Domain + "/reset-password?token=" + url.QueryEscape(token) + "\n\n" +
+			"If you didn't ask for it, just ignore this email.\n",
+	}
+	// Sending in the background, so SMTP doesn't hold the response (& doesn't tell the account exists)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := s.opts.Mailer.Send(ctx, msg); err != nil {
+			log.Printf("on sending a password reset email: %s", err.Error())
+		}
+	}()
+	sendSuccessResp(w, nil)
+}
+
+// CompletePasswordResetHandler sets a new password: {"token": "...", "password": "..."},
+// all the sessions of the user are logged out
+func (s *Server) CompletePasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendErrorResp(w, "on decoding a request body", http.StatusBadRequest)
+		return
+	}
+	user := &models.User{Password: body.Password}
+	if err := user.ValidatePassword(); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reset, err := s.resets.Use(r.Context(), models.HashToken(body.Token), time.Now().Unix())
+	if err == models.ErrNotFound {
+		sendErrorResp(w, "on receiving a reset token which is invalid or expired", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user.ID = reset.UserID
+	user.SessionsValidFrom = time.Now().UnixNano()
+	if err := user.HashPassword(); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.users.Update(r.Context(), user); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.resets.DeleteByUser(r.Context(), user.ID); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sendSuccessResp(w, nil)
+}
@@ -34,3 +34,15 @@ func sendSuccessResp(w http.ResponseWriter, body interface{}) {
 		Body: body,
 	})
 }
+
+// sendRedirectResp tells a client that a resource has moved to location for good,
+// body describes the new location for clients which don't follow redirects
+func sendRedirectResp(w http.ResponseWriter, location string, body interface{}) {
+	w.Header().Set("Location", location)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusMovedPermanently)
+	json.NewEncoder(w).Encode(response{
+		Ok:   true,
+		Body: body,
+	})
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/meddion/web-blog/pkg/diff"
+	"github.com/meddion/web-blog/pkg/models"
+)
+
+// All of the handlers require authorization & are available to users who may change the post
+
+func (s *Server) GetRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	post := s.getEditablePost(w, r)
+	if post == nil {
+		return
+	}
+	revs, err := s.revisions.List(r.Context(), post.ID)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sendSuccessResp(w, revs)
+}
+
+func (s *Server) GetRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	post := s.getEditablePost(w, r)
+	if post == nil {
+		return
+	}
+	rev, err := s.getRevision(r, post, mux.Vars(r)["rev"])
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	sendSuccessResp(w, rev)
+}
+
+// GetRevisionsDiffHandler compares revisions passed as "from" & "to" parameters,
+// the current version of the post is compared if any of them is omitted
+func (s *Server) GetRevisionsDiffHandler(w http.ResponseWriter, r *http.Request) {
+	post := s.getEditablePost(w, r)
+	if post == nil {
+		return
+	}
+	from, err := s.getRevision(r, post, r.URL.Query().Get("from"))
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	to, err := s.getRevision(r, post, r.URL.Query().Get("to"))
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	title, err := diff.Lines(from.Title, to.Title)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	content, err := diff.Lines(from.Content, to.Content)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	sendSuccessResp(w, map[string]interface{}{
+		"from":    from.Rev,
+		"to":      to.Rev,
+		"title":   title,
+		"content": content,
+	})
+}
+
+// RestoreRevisionHandler makes a revision the current version of the post,
+// the version being replaced becomes a new revision
+func (s *Server) RestoreRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := GetUserFromSession(r)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	post := s.getEditablePost(w, r)
+	if post == nil {
+		return
+	}
+	rev, err := s.getRevision(r, post, mux.Vars(r)["rev"])
+	if err != nil {
+		sendErrorResp(w, "on founding the revision", http.StatusNotFound)
+		return
+	}
+	if err := s.revisions.Add(r.Context(), models.NewRevision(post)); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	post.Title, post.Content, post.EditorID = rev.Title, rev.Content, user.ID
+	if err := post.RenderContent(); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.posts.Update(r.Context(), post); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sendSuccessResp(w, nil)
+}
+
+// getRevision returns the revision of the post by its number,
+// an empty number stands for the current version of the post (revision 0)
+func (s *Server) getRevision(r *http.Request, post *models.Post, num string) (*models.Revision, error) {
+	if num == "" {
+		return models.NewRevision(post), nil
+	}
+	rev, err := strconv.ParseInt(num, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return s.revisions.Get(r.Context(), post.ID, rev)
+}
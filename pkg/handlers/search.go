@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/meddion/web-blog/pkg/models"
+)
+
+// SearchHandler looks for posts matching the "q" parameter, a page is chosen by the "page" parameter
+func (s *Server) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		sendErrorResp(w, "on receiving an empty search query", http.StatusBadRequest)
+		return
+	}
+	pageNum, err := strconv.ParseInt(r.URL.Query().Get("page"), 10, 64)
+	if err != nil || pageNum < 1 {
+		pageNum = 1
+	}
+	result, err := s.search.Search(r.Context(), models.SearchQuery{
+		Text:     q,
+		Filter:   visibleTo(r, models.CreatePostFilter(r)),
+		PageSize: postsPerPage,
+		PageNum:  pageNum,
+	})
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sendSuccessResp(w, map[string]interface{}{
+		"totalNumOfHits": result.Total,
+		"postsPerPage":   postsPerPage,
+		"hits":           result.Hits,
+	})
+}
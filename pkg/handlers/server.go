@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/meddion/web-blog/pkg/mail"
+	"github.com/meddion/web-blog/pkg/models"
+	"github.com/meddion/web-blog/pkg/sitemap"
+	"github.com/meddion/web-blog/pkg/throttle"
+)
+
+// Server holds the dependencies shared by our handlers
+type Server struct {
+	posts     models.PostStore
+	users     models.UserStore
+	files     models.FileStore
+	revisions models.RevisionStore
+	comments  models.CommentStore
+	invites   models.InviteStore
+	resets    models.PasswordResetStore
+	tokens    models.APITokenStore
+	lockouts  models.LockoutStore
+	search    models.PostSearcher
+	opts      Options
+}
+
+// Options configure a Server
+type Options struct {
+	Domain string // the address of the client, links given out to readers point there
+	Mailer mail.Mailer
+	// Sitemaps caches URLs of sitemap.xml, sitemaps are built on every request if it's nil
+	Sitemaps *sitemap.Cache
+	// RobotsDisallow lists paths crawlers are asked not to visit by the generated robots.txt
+	RobotsDisallow []string
+	// Robots replaces the generated robots.txt if it's set
+	Robots string
+	// LoginAccounts & LoginAddresses throttle failed logins per account & per client address,
+	// nil limiters allow any number of attempts
+	LoginAccounts  *throttle.Limiter
+	LoginAddresses *throttle.Limiter
+	// TrustProxy makes client addresses to be taken from X-Forwarded-For header
+	TrustProxy bool
+	// MaxUploadSize limits the size of uploaded files (in bytes), no limit if it's zero
+	MaxUploadSize int64
+}
+
+// NewServer returns a Server which handlers use the given stores
+func NewServer(stores *models.Stores, opts Options) *Server {
+	opts.Domain = strings.TrimRight(opts.Domain, "/")
+	return &Server{
+		posts:     stores.Posts,
+		users:     stores.Users,
+		files:     stores.Files,
+		revisions: stores.Revisions,
+		comments:  stores.Comments,
+		invites:   stores.Invites,
+		resets:    stores.Resets,
+		tokens:    stores.Tokens,
+		lockouts:  stores.Lockouts,
+		search:    stores.Search,
+		opts:      opts,
+	}
+}
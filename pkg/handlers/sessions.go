@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/meddion/web-blog/pkg/models"
+	"github.com/meddion/web-blog/pkg/session"
+)
+
+// All of the handlers require authorization & manage the sessions of the logged-in user
+
+type sessionInfo struct {
+	ID        string `json:"id"` // the handle of the session, not the ID of it
+	UserAgent string `json:"user_agent"`
+	IP        string `json:"ip"`
+	Created   int64  `json:"created"`
+	LastSeen  int64  `json:"last_seen"`
+	Current   bool   `json:"current"`
+}
+
+// GetSessionsHandler lists the devices the user is logged in from, the most recently used first
+func (s *Server) GetSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	current, infos, ok := s.userSessions(w, r)
+	if !ok {
+		return
+	}
+	sessions := make([]*sessionInfo, 0, len(infos))
+	for _, info := range infos {
+		sessions = append(sessions, &sessionInfo{
+			ID:        info.Handle(),
+			UserAgent: info.Device.UserAgent,
+			IP:        info.Device.IP,
+			Created:   info.Created.Unix(),
+			LastSeen:  info.LastSeen.Unix(),
+			Current:   info.ID == current.GetSessionID(),
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeen > sessions[j].LastSeen })
+	sendSuccessResp(w, sessions)
+}
+
+// DeleteSessionHandler logs out the session with the handle given as id
+func (s *Server) DeleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	_, infos, ok := s.userSessions(w, r)
+	if !ok {
+		return
+	}
+	handle := mux.Vars(r)["id"]
+	for _, info := range infos {
+		if info.Handle() != handle {
+			continue
+		}
+		manager, err := getManager(r)
+		if err != nil {
+			sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := manager.Destroy(info.ID); err != nil {
+			sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sendSuccessResp(w, nil)
+		return
+	}
+	sendErrorResp(w, "on founding the session", http.StatusNotFound)
+}
+
+// DeleteOtherSessionsHandler logs out every session of the user but the current one
+func (s *Server) DeleteOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	current, err := GetSession(r)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user, err := GetUserFromSession(r)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	manager, err := getManager(r)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Revoking the sessions by time works for the providers which can't look sessions up as well,
+	// the current session is logged in anew after that
+	if err := s.users.Update(r.Context(), &models.User{ID: user.ID, SessionsValidFrom: time.Now().UnixNano()}); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.logIn(r, current, user); err != nil {
+		sendErrorResp(w, "on saving a user's object into session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	infos, err := manager.SessionsByUser(user.ID.Hex())
+	if err != nil && err != session.ErrNotSupported {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, info := range infos {
+		if info.ID == current.GetSessionID() {
+			continue
+		}
+		if err := manager.Destroy(info.ID); err != nil {
+			sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	sendSuccessResp(w, nil)
+}
+
+// userSessions returns the current session along with the sessions of the user,
+// an error is sent if they can't be got
+func (s *Server) userSessions(w http.ResponseWriter, r *http.Request) (session.Session, []session.Info, bool) {
+	current, err := GetSession(r)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	user, err := GetUserFromSession(r)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	manager, err := getManager(r)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	infos, err := manager.SessionsByUser(user.ID.Hex())
+	if err == session.ErrNotSupported {
+		sendErrorResp(w, err.Error(), http.StatusNotImplemented)
+		return nil, nil, false
+	} else if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return current, infos, true
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/meddion/web-blog/pkg/models"
+	"github.com/meddion/web-blog/pkg/sitemap"
+)
+
+// sitemapPageSize is the number of posts read at once while building a sitemap
+const sitemapPageSize = 500
+
+// Handlers which do not require user to be authorized
+
+// SitemapHandler lists every public post & author page, or sitemaps listing them
+// if there are more URLs than a single sitemap can have
+func (s *Server) SitemapHandler(w http.ResponseWriter, r *http.Request) {
+	urls, err := s.opts.Sitemaps.Get(func() ([]sitemap.URL, error) { return s.buildSitemap(r) })
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	parts := sitemap.Split(urls, sitemap.MaxURLs)
+	if len(parts) == 1 {
+		sendSitemap(w, r, parts[0], sitemap.EncodeURLSet)
+		return
+	}
+	sitemaps := make([]sitemap.URL, len(parts))
+	for i, part := range parts {
+		sitemaps[i] = sitemap.URL{
+			Loc:     s.opts.Domain + "/sitemap-" + strconv.Itoa(i+1) + ".xml",
+			LastMod: sitemap.LastMod(part),
+		}
+	}
+	sendSitemap(w, r, sitemaps, sitemap.EncodeIndex)
+}
+
+// SitemapPartHandler serves the sitemaps listed in the sitemap index
+func (s *Server) SitemapPartHandler(w http.ResponseWriter, r *http.Request) {
+	urls, err := s.opts.Sitemaps.Get(func() ([]sitemap.URL, error) { return s.buildSitemap(r) })
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	parts := sitemap.Split(urls, sitemap.MaxURLs)
+	n, err := strconv.Atoi(mux.Vars(r)["n"])
+	if err != nil || n < 1 || n > len(parts) || len(parts) == 1 {
+		http.NotFound(w, r)
+		return
+	}
+	sendSitemap(w, r, parts[n-1], sitemap.EncodeURLSet)
+}
+
+func (s *Server) RobotsHandler(w http.ResponseWriter, r *http.Request) {
+	robots := s.opts.Robots
+	if robots == "" {
+		var b strings.Builder
+		b.WriteString("User-agent: *\n")
+		for _, path := range s.opts.RobotsDisallow {
+			b.WriteString("Disallow: " + path + "\n")
+		}
+		b.WriteString("\nSitemap: " + s.opts.Domain + "/sitemap.xml\n")
+		robots = b.String()
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(robots))
+}
+
+func sendSitemap(w http.ResponseWriter, r *http.Request, urls []sitemap.URL, encode func([]sitemap.URL) ([]byte, error)) {
+	body, err := encode(urls)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	http.ServeContent(w, r, "", sitemap.LastMod(urls), bytes.NewReader(body))
+}
+
+// buildSitemap lists the home page, published posts & pages of their authors
+func (s *Server) buildSitemap(r *http.Request) ([]sitemap.URL, error) {
+	urls := []sitemap.URL{{Loc: s.opts.Domain + "/"}}
+	authors := make(map[string]time.Time)
+	filter := models.PostFilter{VisibleAt: time.Now().Unix()}
+	for page := int64(1); ; page++ {
+		posts, err := s.posts.List(r.Context(), models.PostsQuery{Filter: filter, PageSize: sitemapPageSize, PageNum: page})
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range posts {
+			lastMod := time.Unix(p.PublicationTime(), 0)
+			if p.LastEdited != 0 {
+				lastMod = time.Unix(p.LastEdited, 0)
+			}
+			urls = append(urls, sitemap.URL{Loc: s.postURL(&p.Post), LastMod: lastMod})
+			if name := p.Author.Name; name != "" && lastMod.After(authors[name]) {
+				authors[name] = lastMod
+			}
+		}
+		if len(posts) < sitemapPageSize {
+			break
+		}
+	}
+	urls[0].LastMod = sitemap.LastMod(urls)
+	names := make([]string, 0, len(authors))
+	for name := range authors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		urls = append(urls, sitemap.URL{Loc: s.opts.Domain + "/author/" + url.PathEscape(name), LastMod: authors[name]})
+	}
+	return urls, nil
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/meddion/web-blog/pkg/models/memory"
+	"github.com/meddion/web-blog/pkg/sitemap"
+)
+
+// Sitemaps & robots.txt are served by the API host, the URLs they give out point to the domain of the blog
+func TestSitemapURLs(t *testing.T) {
+	cache := &sitemap.Cache{}
+	cache.Get(func() ([]sitemap.URL, error) {
+		return make([]sitemap.URL, sitemap.MaxURLs+1), nil
+	})
+	srv := NewServer(memory.NewStores(), Options{Domain: "https://blog.example", Sitemaps: cache})
+
+	rec := httptest.NewRecorder()
+	srv.SitemapHandler(rec, httptest.NewRequest("GET", "http://api.example/sitemap.xml", nil))
+	if body := rec.Body.String(); !strings.Contains(body, "<loc>https://blog.example/sitemap-2.xml</loc>") ||
+		strings.Contains(body, "api.example") {
+		t.Fatalf("expected the sitemap index to list sitemaps of the blog, instead we got: %s", body)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.RobotsHandler(rec, httptest.NewRequest("GET", "http://api.example/robots.txt", nil))
+	if body := rec.Body.String(); !strings.Contains(body, "Sitemap: https://blog.example/sitemap.xml\n") {
+		t.Fatalf("expected robots.txt to point to the sitemap of the blog, instead we got: %s", body)
+	}
+}
@@ -1,11 +1,17 @@
 package handlers
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"log"
 	"mime"
+	"net"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,22 +21,30 @@ import (
 )
 
 // StaticHandler serves static files from [staticPath] folder
-func StaticHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) StaticHandler(w http.ResponseWriter, r *http.Request) {
 	dir, filename, ext := extractDirFilenameExt(mux.Vars(r)["path"])
 	file := models.File{Dir: dir, Name: filename, Ext: ext}
-	// Return the file from DB
-	if err := file.Get(r.Context()); err != nil {
+	// Streaming the file from DB
+	content, err := s.files.Open(r.Context(), &file)
+	if err != nil {
+		if err == models.ErrNotFound {
+			sendErrorResp(w, "the file wasn't found", http.StatusNotFound)
+			return
+		}
 		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	defer content.Close()
 	w.Header().Set("Content-Type", mime.TypeByExtension("."+file.Ext))
-	if _, err := w.Write(file.File.Data); err != nil {
-		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+	w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	// The status is sent along with the first bytes, so errors can only be logged from here
+	if _, err := io.Copy(&deadlineWriter{w: w, conn: getConn(r)}, content); err != nil {
+		log.Printf("on sending the file %s: %s", mux.Vars(r)["path"], err.Error())
 	}
 }
 
 // DeleteFileHandler is used for deleting files from the static dir
-func DeleteFileHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) DeleteFileHandler(w http.ResponseWriter, r *http.Request) {
 	if isPathEmpty(mux.Vars(r)["path"]) {
 		sendErrorResp(w, "the path to the file is empty", http.StatusBadRequest)
 		return
@@ -38,10 +52,10 @@ func DeleteFileHandler(w http.ResponseWriter, r *http.Request) {
 	dir, filename, ext := extractDirFilenameExt(mux.Vars(r)["path"])
 	file := models.NewEmptyFile(dir, filename, ext)
 	// Remove file from DB
-	if res, err := file.Delete(r.Context()); err != nil {
-		sendErrorResp(w, err.Error(), http.StatusBadRequest)
-	} else if res.DeletedCount == 0 {
+	if err := s.files.Delete(r.Context(), file); err == models.ErrNotFound {
 		sendErrorResp(w, "the file wasn't found, thus wasn't deleted", http.StatusBadRequest)
+	} else if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusBadRequest)
 	} else {
 		sendSuccessResp(w, nil)
 	}
@@ -50,36 +64,127 @@ func DeleteFileHandler(w http.ResponseWriter, r *http.Request) {
 // AddFileHandler is used for adding files to the static dir.
 // If the file with a specified name and extension
 // already exists in the folder - replace it.
-func AddFileHandler(w http.ResponseWriter, r *http.Request) {
-	// Getting the byte slice from the request body
-	data, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		sendErrorResp(w, err.Error(), http.StatusBadRequest)
+func (s *Server) AddFileHandler(w http.ResponseWriter, r *http.Request) {
+	// Refusing files which are known to be too large before reading them
+	limit := s.opts.MaxUploadSize
+	if limit > 0 && r.ContentLength > limit {
+		sendErrorResp(w, errUploadTooLarge.Error(), http.StatusRequestEntityTooLarge)
 		return
 	}
+	body := io.Reader(&deadlineReader{r: r.Body, conn: getConn(r)})
+	if limit > 0 {
+		body = &uploadLimiter{r: body, left: limit}
+	}
+	content := bufio.NewReaderSize(body, sniffLen)
+
 	// Extracting directory, filename and extension info
 	dir, filename, ext := extractDirFilenameExt(mux.Vars(r)["path"])
 	if filename == "" {
 		filename = fmt.Sprintf("%d", time.Now().Unix())
 	}
 	if ext == "" {
-		ext = strings.TrimLeft(mimetype.Detect(data).Extension(), ".")
+		// Detecting the type by the beginning of the body, which is still read by Save afterwards
+		head, err := content.Peek(sniffLen)
+		if err != nil && err != io.EOF {
+			sendUploadErr(w, err)
+			return
+		}
+		ext = strings.TrimLeft(mimetype.Detect(head).Extension(), ".")
 	}
 
-	file := models.NewFile(dir, filename, ext, data)
-	// Saving the file as a blob into DB
-	if _, err = file.Save(r.Context()); err != nil {
-		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+	file := models.NewEmptyFile(dir, filename, ext)
+	// Streaming the body into DB
+	if _, err := s.files.Save(r.Context(), file, content); err != nil {
+		sendUploadErr(w, err)
 		return
 	}
 	sendSuccessResp(w, nil)
 }
 
+// sniffLen is the number of bytes the type of a file is detected by
+const sniffLen = 3072
+
+var errUploadTooLarge = errors.New("on uploading a file larger than allowed")
+
+// uploadLimiter fails reading the body of a request once it's longer than left bytes
+type uploadLimiter struct {
+	r    io.Reader
+	left int64
+}
+
+func (l *uploadLimiter) Read(p []byte) (int, error) {
+	// Reading one byte more than allowed tells if the body is too large
+	if int64(len(p)) > l.left+1 {
+		p = p[:l.left+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.left {
+		l.left = 0
+		return 0, errUploadTooLarge
+	}
+	l.left -= int64(n)
+	return n, err
+}
+
+// transferTimeout limits the time a chunk of a streamed file can take to be read or written,
+// the whole transfer isn't limited, so large files aren't cut by the timeouts of the server
+const transferTimeout = 30 * time.Second
+
+type connContextKey struct{}
+
+// ConnContext keeps the connection of requests in their context (to be set as http.Server.ConnContext),
+// so handlers streaming files can extend the deadlines of the connection set by the server
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, c)
+}
+
+// getConn returns the connection of r, nil if it isn't kept in the context
+func getConn(r *http.Request) net.Conn {
+	conn, _ := r.Context().Value(connContextKey{}).(net.Conn)
+	return conn
+}
+
+// deadlineReader extends the deadlines of conn before every read,
+// the write deadline as well since the response is sent after the body is read
+type deadlineReader struct {
+	r    io.Reader
+	conn net.Conn
+}
+
+func (d *deadlineReader) Read(p []byte) (int, error) {
+	if d.conn != nil {
+		d.conn.SetDeadline(time.Now().Add(transferTimeout))
+	}
+	return d.r.Read(p)
+}
+
+// deadlineWriter extends the write deadline of conn before every write
+type deadlineWriter struct {
+	w    io.Writer
+	conn net.Conn
+}
+
+func (d *deadlineWriter) Write(p []byte) (int, error) {
+	if d.conn != nil {
+		d.conn.SetWriteDeadline(time.Now().Add(transferTimeout))
+	}
+	return d.w.Write(p)
+}
+
+// sendUploadErr responds to an upload which failed with err
+func sendUploadErr(w http.ResponseWriter, err error) {
+	if err == errUploadTooLarge {
+		sendErrorResp(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+}
+
 // GetFilenamesHandler is used for getting filenames in folders with a specific extention
-func GetFilenamesHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetFilenamesHandler(w http.ResponseWriter, r *http.Request) {
 	dir, ext, _ := extractDirFilenameExt(mux.Vars(r)["path"])
 
-	filenames, err := models.ListFilenamesWhere(r.Context(), dir, ext)
+	filenames, err := s.files.ListFilenames(r.Context(), dir, ext)
 	if err != nil {
 		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/meddion/web-blog/pkg/models/memory"
+)
+
+func TestAddFileHandler(t *testing.T) {
+	srv := NewServer(memory.NewStores(), Options{MaxUploadSize: 8})
+	upload := func(body string, length int64) int {
+		r := httptest.NewRequest("POST", "/api/static/test/file.txt", strings.NewReader(body))
+		r.ContentLength = length
+		r = mux.SetURLVars(r, map[string]string{"path": "test/file.txt"})
+		rec := httptest.NewRecorder()
+		srv.AddFileHandler(rec, r)
+		return rec.Code
+	}
+	if code := upload("12345678", 8); code != http.StatusAccepted {
+		t.Fatalf("on uploading a file within the limit expected code %d, instead we got: %d", http.StatusAccepted, code)
+	}
+	// Bodies over the limit are refused by their length or once they are read that far (if it's unknown)
+	if code := upload("123456789", 9); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("on uploading a file of a known length over the limit expected code 413, instead we got: %d", code)
+	}
+	if code := upload("123456789", -1); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("on uploading a file of an unknown length over the limit expected code 413, instead we got: %d", code)
+	}
+
+	r := mux.SetURLVars(httptest.NewRequest("GET", "/static/test/file.txt", nil), map[string]string{"path": "test/file.txt"})
+	rec := httptest.NewRecorder()
+	srv.StaticHandler(rec, r)
+	if rec.Body.String() != "12345678" || rec.Header().Get("Content-Length") != "8" {
+		t.Fatalf("expected the file uploaded within the limit to be kept, instead we got: %q", rec.Body.String())
+	}
+}
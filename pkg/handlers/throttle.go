@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/models"
+	"github.com/meddion/web-blog/pkg/throttle"
+)
+
+const lockoutsPerPage int64 = 100
+
+// GetLockoutsHandler returns the latest lockouts of logging in, requires authorization & is available to admins
+func (s *Server) GetLockoutsHandler(w http.ResponseWriter, r *http.Request) {
+	lockouts, err := s.lockouts.List(r.Context(), lockoutsPerPage)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sendSuccessResp(w, lockouts)
+}
+
+type loginKey struct {
+	kind    string
+	key     string
+	limiter *throttle.Limiter
+}
+
+// loginKeys returns the keys failed logins as name are counted by: the account & the client's address
+func (s *Server) loginKeys(r *http.Request, name string) []loginKey {
+	return []loginKey{
+		{models.LockoutAccount, strings.ToLower(name), s.opts.LoginAccounts},
+		{models.LockoutAddress, s.clientAddr(r), s.opts.LoginAddresses},
+	}
+}
+
+// loginAttempt is an attempt to log in reserved by startLogin, which has to be ended by failed or succeeded,
+// or released if it ends otherwise (e.g. on an internal error)
+type loginAttempt struct {
+	s     *Server
+	r     *http.Request
+	name  string
+	keys  []loginKey
+	ended bool
+}
+
+// startLogin sends 429 code if logging in as name or from the client's address is locked out, otherwise
+// it reserves the attempt, atomically, so concurrent attempts can't all pass the check before any of them fails
+func (s *Server) startLogin(w http.ResponseWriter, r *http.Request, name string) (*loginAttempt, bool) {
+	a := &loginAttempt{s: s, r: r, name: name}
+	for _, k := range s.loginKeys(r, name) {
+		left, err := k.limiter.Reserve(r.Context(), k.key)
+		if err != nil || left > 0 {
+			a.release()
+			if err != nil {
+				sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+			} else {
+				sendLockedOut(w, left)
+			}
+			return nil, false
+		}
+		a.keys = append(a.keys, k)
+	}
+	return a, true
+}
+
+// failed counts the failed attempt & sends 401 code with msg,
+// or 429 code if the attempt has led to a lockout which is recorded then
+func (a *loginAttempt) failed(w http.ResponseWriter, msg string) {
+	a.ended = true
+	var lockedFor time.Duration
+	for _, k := range a.keys {
+		left, record, err := k.limiter.Fail(a.r.Context(), k.key)
+		if err != nil {
+			sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if left == 0 {
+			continue
+		}
+		if err := a.s.recordLockout(a.r.Context(), k, a.r, record, left); err != nil {
+			sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if left > lockedFor {
+			lockedFor = left
+		}
+	}
+	if lockedFor > 0 {
+		sendLockedOut(w, lockedFor)
+		return
+	}
+	sendErrorResp(w, msg, http.StatusUnauthorized)
+}
+
+// succeeded forgets failed attempts to log in as name,
+// the ones from the client's address are kept as it may be guessing other accounts
+func (a *loginAttempt) succeeded() {
+	a.ended = true
+	for _, k := range a.keys {
+		end := k.limiter.Release
+		if k.kind == models.LockoutAccount {
+			end = k.limiter.Succeed
+		}
+		if err := end(a.r.Context(), k.key); err != nil {
+			log.Printf("on ending an attempt to log in as %q: %s", a.name, err.Error())
+		}
+	}
+}
+
+// release ends the attempt without counting it unless it's ended already, it's meant to be deferred
+func (a *loginAttempt) release() {
+	if a.ended {
+		return
+	}
+	a.ended = true
+	for _, k := range a.keys {
+		if err := k.limiter.Release(a.r.Context(), k.key); err != nil {
+			log.Printf("on ending an attempt to log in as %q: %s", a.name, err.Error())
+		}
+	}
+}
+
+func (s *Server) recordLockout(ctx context.Context, k loginKey, r *http.Request, record throttle.Record, left time.Duration) error {
+	lockout := &models.Lockout{
+		Kind:        k.kind,
+		Key:         k.key,
+		Address:     s.clientAddr(r),
+		Failures:    int64(record.Failures),
+		LockedUntil: time.Now().Add(left).Unix(),
+	}
+	log.Printf("Locking out logging in by %s %q for %s after %d failed attempts", k.kind, k.key, left.Round(time.Second), record.Failures)
+	return s.lockouts.Create(ctx, lockout)
+}
+
+func sendLockedOut(w http.ResponseWriter, left time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(left.Seconds()))))
+	sendErrorResp(w, "on making too many failed attempts to log in, try again later", http.StatusTooManyRequests)
+}
+
+// clientAddr returns the IP address of the client, X-Forwarded-For header is used if we are behind a proxy
+func (s *Server) clientAddr(r *http.Request) string {
+	if s.opts.TrustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			// The proxy appends the address it got the request from
+			addrs := strings.Split(forwarded, ",")
+			return strings.TrimSpace(addrs[len(addrs)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/meddion/web-blog/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// All of the handlers require authorization & manage API tokens of the logged-in user
+
+// CreateAPITokenHandler makes a token: {"name": "ci", "scopes": ["posts:write"], "expires_in": <seconds>},
+// the token is returned only once & has to be passed in the "Authorization: Bearer <token>" header
+func (s *Server) CreateAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := GetUserFromSession(r)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body := struct {
+		Name      string   `json:"name"`
+		Scopes    []string `json:"scopes"`
+		ExpiresIn int64    `json:"expires_in"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendErrorResp(w, "on decoding a request body", http.StatusBadRequest)
+		return
+	}
+	apiToken, token, err := models.NewAPIToken(user.ID, body.Name, body.Scopes, time.Duration(body.ExpiresIn)*time.Second)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.tokens.Create(r.Context(), apiToken); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sendSuccessResp(w, map[string]interface{}{"api_token": apiToken, "token": token})
+}
+
+func (s *Server) GetAPITokensHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := GetUserFromSession(r)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tokens, err := s.tokens.ListByUser(r.Context(), user.ID)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sendSuccessResp(w, tokens)
+}
+
+// RevokeAPITokenHandler deletes a token of the user, so it can't be used anymore
+func (s *Server) RevokeAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := GetUserFromSession(r)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.tokens.Delete(r.Context(), user.ID, id); err == models.ErrNotFound {
+		sendErrorResp(w, "on founding the API token", http.StatusNotFound)
+		return
+	} else if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sendSuccessResp(w, nil)
+}
+
+// requestSession keeps the values of a session for a single request,
+// it's used for requests authorized with API tokens
+type requestSession map[interface{}]interface{}
+
+func newRequestSession() requestSession {
+	return make(requestSession)
+}
+
+func (s requestSession) Set(key, value interface{}) error {
+	s[key] = value
+	return nil
+}
+
+func (s requestSession) Get(key interface{}) interface{} {
+	return s[key]
+}
+
+func (s requestSession) Delete(key interface{}) error {
+	delete(s, key)
+	return nil
+}
+
+func (s requestSession) IsValuePresent(key interface{}) bool {
+	_, ok := s[key]
+	return ok
+}
+
+func (s requestSession) GetSessionID() string {
+	return ""
+}
+
+func (s requestSession) Keys() []interface{} {
+	keys := make([]interface{}, 0, len(s))
+	for key := range s {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/models"
+	"github.com/meddion/web-blog/pkg/session"
+	"github.com/meddion/web-blog/pkg/totp"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	pendingLoginTTL         = 5 * time.Minute
+	maxSecondFactorAttempts = 5
+)
+
+// Handlers which do not require user to be authorized
+
+// LoginSecondFactorHandler completes logging in of a user with 2FA enabled: {"code": "..."},
+// the code is either a TOTP or a recovery one
+func (s *Server) LoginSecondFactorHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := GetSession(r)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	userID, ok := session.Get("PENDING_USER").(primitive.ObjectID)
+	startedAt, _ := session.Get("PENDING_TIME").(int64)
+	if !ok || time.Since(time.Unix(startedAt, 0)) > pendingLoginTTL {
+		clearPendingLogin(session)
+		sendErrorResp(w, "on finding a login waiting for the second factor", http.StatusUnauthorized)
+		return
+	}
+	body := struct {
+		Code string `json:"code"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendErrorResp(w, "on decoding a request body", http.StatusBadRequest)
+		return
+	}
+	user, err := s.users.GetByID(r.Context(), userID)
+	if err != nil {
+		clearPendingLogin(session)
+		sendErrorResp(w, "on matching the credentials for a user", http.StatusUnauthorized)
+		return
+	}
+	attempt, ok := s.startLogin(w, r, user.Name)
+	if !ok {
+		return
+	}
+	defer attempt.release()
+	used, err := s.useSecondFactor(r.Context(), user, body.Code)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !used {
+		attempts, _ := session.Get("PENDING_ATTEMPTS").(int)
+		if attempts+1 >= maxSecondFactorAttempts {
+			// Starting over with the password
+			clearPendingLogin(session)
+		} else {
+			session.Set("PENDING_ATTEMPTS", attempts+1)
+		}
+		attempt.failed(w, "on matching the code of the second factor")
+		return
+	}
+	clearPendingLogin(session)
+	if session, err = s.regenerateSession(w, r, session); err != nil {
+		sendErrorResp(w, "on regenerating a session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.logIn(r, session, user); err != nil {
+		sendErrorResp(w, "on saving a user's object into session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	attempt.succeeded()
+	sendSuccessResp(w, nil)
+}
+
+// Require authorization
+
+// EnrollTOTPHandler generates a new TOTP secret of the user, it's used once confirmed by ConfirmTOTPHandler
+func (s *Server) EnrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := GetUserFromSession(r)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if user.HasTwoFactor() {
+		sendErrorResp(w, "on enabling 2FA which is already enabled", http.StatusBadRequest)
+		return
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.users.SetTOTP(r.Context(), user.ID, &models.TOTP{Secret: secret}); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	issuer := s.opts.Domain
+	if u, err := url.Parse(s.opts.Domain); err == nil && u.Host != "" {
+		issuer = u.Host
+	}
+	sendSuccessResp(w, map[string]string{
+		"secret": secret,
+		"uri":    totp.URI(issuer, user.Name, secret),
+	})
+}
+
+// ConfirmTOTPHandler enables 2FA once the first code is received: {"code": "..."},
+// recovery codes are returned only once
+func (s *Server) ConfirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := GetUserFromSession(r)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if user.TOTP == nil || user.TOTP.Enabled {
+		sendErrorResp(w, "on confirming 2FA which isn't being enabled", http.StatusBadRequest)
+		return
+	}
+	body := struct {
+		Code string `json:"code"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendErrorResp(w, "on decoding a request body", http.StatusBadRequest)
+		return
+	}
+	if !user.TOTP.Verify(body.Code, time.Now()) {
+		sendErrorResp(w, "on matching the code of the second factor", http.StatusBadRequest)
+		return
+	}
+	user.TOTP.Enabled = true
+	codes, err := user.TOTP.NewRecoveryCodes()
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.users.SetTOTP(r.Context(), user.ID, user.TOTP); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !s.renewSession(w, r) {
+		return
+	}
+	sendSuccessResp(w, map[string][]string{"recovery_codes": codes})
+}
+
+// DisableTOTPHandler turns 2FA off after checking the password & a TOTP or recovery code:
+// {"password": "...", "code": "..."}, failed attempts are throttled as the ones to log in
+func (s *Server) DisableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := GetUserFromSession(r)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body := struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendErrorResp(w, "on decoding a request body", http.StatusBadRequest)
+		return
+	}
+	attempt, ok := s.startLogin(w, r, user.Name)
+	if !ok {
+		return
+	}
+	defer attempt.release()
+	match, err := models.CompareHashAndPassword(user.Password, body.Password)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !match {
+		attempt.failed(w, "on matching the credentials for a user")
+		return
+	}
+	// 2FA which is being enabled isn't confirmed by a code yet
+	if user.HasTwoFactor() {
+		used, err := s.useSecondFactor(r.Context(), user, body.Code)
+		if err != nil {
+			sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !used {
+			attempt.failed(w, "on matching the code of the second factor")
+			return
+		}
+	}
+	attempt.succeeded()
+	if err := s.users.SetTOTP(r.Context(), user.ID, nil); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !s.renewSession(w, r) {
+		return
+	}
+	sendSuccessResp(w, nil)
+}
+
+// useSecondFactor checks a TOTP or recovery code of the user with 2FA enabled & marks it as used,
+// false is returned if the code is wrong or it has been used already (even by a concurrent request)
+func (s *Server) useSecondFactor(ctx context.Context, user *models.User, code string) (bool, error) {
+	if !user.HasTwoFactor() {
+		return false, nil
+	}
+	prev := *user.TOTP
+	if !user.TOTP.Verify(code, time.Now()) {
+		return false, nil
+	}
+	err := s.users.UseTOTP(ctx, user.ID, &prev, user.TOTP)
+	if err == models.ErrCodeUsed {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// renewSession moves the session of the request to a new ID as the security of the account has changed,
+// 500 code is sent if it fails
+func (s *Server) renewSession(w http.ResponseWriter, r *http.Request) bool {
+	session, err := GetSession(r)
+	if err == nil {
+		_, err = s.regenerateSession(w, r, session)
+	}
+	if err != nil {
+		sendErrorResp(w, "on regenerating a session: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// startPendingLogin marks the session as half-authenticated: the password of the user matched,
+// but the second factor is still awaited
+func startPendingLogin(s session.Session, user *models.User) error {
+	if err := s.Set("PENDING_USER", user.ID); err != nil {
+		return err
+	}
+	if err := s.Set("PENDING_ATTEMPTS", 0); err != nil {
+		return err
+	}
+	return s.Set("PENDING_TIME", time.Now().Unix())
+}
+
+func clearPendingLogin(s session.Session) {
+	s.Delete("PENDING_USER")
+	s.Delete("PENDING_ATTEMPTS")
+	s.Delete("PENDING_TIME")
+}
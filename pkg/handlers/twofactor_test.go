@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/models"
+	"github.com/meddion/web-blog/pkg/models/memory"
+	"github.com/meddion/web-blog/pkg/totp"
+)
+
+func TestDisableTOTPHandler(t *testing.T) {
+	stores := memory.NewStores()
+	srv := NewServer(stores, Options{})
+	secret, err := totp.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{Name: "alice", Password: "Password123!"}
+	if err := user.HashPassword(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Users.Create(context.TODO(), user); err != nil {
+		t.Fatalf("on creating a user: %s", err.Error())
+	}
+	if err := stores.Users.SetTOTP(context.TODO(), user.ID, &models.TOTP{Secret: secret, Enabled: true}); err != nil {
+		t.Fatalf("on enabling 2FA: %s", err.Error())
+	}
+	disable := func(body string) int {
+		user, err := stores.Users.GetByID(context.TODO(), user.ID)
+		if err != nil {
+			t.Fatalf("on getting the user: %s", err.Error())
+		}
+		rec := httptest.NewRecorder()
+		srv.DisableTOTPHandler(rec, withUser(httptest.NewRequest("DELETE", "/api/account/2fa", strings.NewReader(body)), user))
+		return rec.Code
+	}
+
+	if code := disable(`{"password":"Password123!"}`); code != http.StatusUnauthorized {
+		t.Fatalf("on disabling 2FA without a code expected code %d, instead we got: %d", http.StatusUnauthorized, code)
+	}
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := disable(fmt.Sprintf(`{"password":"wrong","code":%q}`, code)); got != http.StatusUnauthorized {
+		t.Fatalf("on disabling 2FA with a wrong password expected code %d, instead we got: %d", http.StatusUnauthorized, got)
+	}
+	if got := disable(fmt.Sprintf(`{"password":"Password123!","code":%q}`, code)); got != http.StatusAccepted {
+		t.Fatalf("on disabling 2FA expected code %d, instead we got: %d", http.StatusAccepted, got)
+	}
+	if got, err := stores.Users.GetByID(context.TODO(), user.ID); err != nil || got.TOTP != nil {
+		t.Fatalf("expected 2FA to be disabled, instead we got: %v (%v)", got, err)
+	}
+}
@@ -4,16 +4,17 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/meddion/web-blog/pkg/models"
 	"github.com/meddion/web-blog/pkg/session"
-	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // Handlers which do not require user to be authorized
 
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	// Checking if a user is already logged in
 
 	session, ok := r.Context().Value("session").(session.Session)
@@ -21,7 +22,7 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		sendErrorResp(w, "on retrieving a session from a request's context", http.StatusInternalServerError)
 		return
 	}
-	if session.IsValuePresent("USER") {
+	if session.IsValuePresent("USER_ID") {
 		sendSuccessResp(w, nil)
 		return
 	}
@@ -35,10 +36,16 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		sendErrorResp(w, "on matching the credentials for a user", http.StatusUnauthorized)
 		return
 	}
-	passwordFromRequest := user.Password
-	if err := user.Get(r.Context()); err != nil {
-		if err == mongo.ErrNoDocuments {
-			sendErrorResp(w, "on matching the credentials for a user", http.StatusUnauthorized)
+	name, passwordFromRequest := user.Name, user.Password
+	attempt, ok := s.startLogin(w, r, name)
+	if !ok {
+		return
+	}
+	defer attempt.release()
+	user, err := s.users.GetByName(r.Context(), name)
+	if err != nil {
+		if err == models.ErrNotFound {
+			attempt.failed(w, "on matching the credentials for a user")
 			return
 		}
 		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
@@ -50,46 +57,82 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if !match {
-		sendErrorResp(w, "on matching the credentials for a user", http.StatusUnauthorized)
+		attempt.failed(w, "on matching the credentials for a user")
+		return
+	}
+	// Users with 2FA are logged in by LoginSecondFactorHandler once the code is received
+	if user.HasTwoFactor() {
+		if err := startPendingLogin(session, user); err != nil {
+			sendErrorResp(w, "on saving a pending login into session: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sendSuccessResp(w, map[string]bool{"two_factor_required": true})
 		return
 	}
 	// Creates a session & puts user's object there
-	if err := session.Set("USER", user); err != nil {
+	if session, err = s.regenerateSession(w, r, session); err != nil {
+		sendErrorResp(w, "on regenerating a session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.logIn(r, session, user); err != nil {
 		sendErrorResp(w, "on saving a user's object into session: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	attempt.succeeded()
 
 	sendSuccessResp(w, nil)
 }
 
-func SignupHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) SignupHandler(w http.ResponseWriter, r *http.Request) {
 	// Checking if a user is already logged in
 	session, ok := r.Context().Value("session").(session.Session)
 	if !ok {
 		sendErrorResp(w, "on retrieving a session from a request's context", http.StatusInternalServerError)
 		return
 	}
-	if session.IsValuePresent("USER") {
+	if session.IsValuePresent("USER_ID") {
 		sendErrorResp(w, "", http.StatusBadRequest)
 		return
 	}
 
-	user := &models.User{}
-	if err := json.NewDecoder(r.Body).Decode(user); err != nil {
+	form := struct {
+		models.User
+		Invite string `json:"invite"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
 		sendErrorResp(w, "on decoding a request body", http.StatusBadRequest)
 		return
 	}
-	if err := user.ValidateSignupForm(r.Context()); err != nil {
+	user := &form.User
+	if err := user.ValidateSignupForm(r.Context(), s.users); err != nil {
 		sendErrorResp(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	// The role of a new account is given by the invite
+	invite, err := s.invites.Use(r.Context(), models.HashToken(form.Invite), time.Now().Unix())
+	if err == models.ErrNotFound {
+		sendErrorResp(w, "on receiving an invite which is invalid, expired or used up", http.StatusForbidden)
+		return
+	} else if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user.Role = invite.Role
 
-	if err := user.Create(r.Context()); err != nil {
+	if err := user.HashPassword(); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.users.Create(r.Context(), user); err != nil {
 		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	// Creates a session & puts user's object there
-	if err := session.Set("USER", user); err != nil {
+	if session, err = s.regenerateSession(w, r, session); err != nil {
+		sendErrorResp(w, "on regenerating a session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.logIn(r, session, user); err != nil {
 		sendErrorResp(w, "on saving a user's object into session: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -97,30 +140,30 @@ func SignupHandler(w http.ResponseWriter, r *http.Request) {
 	sendSuccessResp(w, nil)
 }
 
-func GetAccountByNameHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetAccountByNameHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	user, err := models.GetUserInfoByName(r.Context(), vars["name"])
+	user, err := s.users.GetByName(r.Context(), vars["name"])
 	if err != nil {
 		sendErrorResp(w, "on founding the user", http.StatusNotFound)
 		return
 	}
-	sendSuccessResp(w, user)
+	sendSuccessResp(w, user.PublicInfo())
 }
 
 // Require authorization
 
-func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	// Checking if a *session.Manager instance was passed
-	manager, ok := r.Context().Value("manager").(*session.Manager)
-	if !ok {
-		sendErrorResp(w, "on retrieving a manager (*session.Manager) from a request's context", http.StatusInternalServerError)
+	manager, err := getManager(r)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	manager.SessionDestroy(w, r)
 	sendSuccessResp(w, nil)
 }
 
-func GetAccountHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetAccountHandler(w http.ResponseWriter, r *http.Request) {
 	user, err := GetUserFromSession(r)
 	if err != nil {
 		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
@@ -128,19 +171,21 @@ func GetAccountHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	copyUser := *user
 	copyUser.Password = ""
-	sendSuccessResp(w, copyUser)
+	sendSuccessResp(w, struct {
+		models.User
+		TwoFactor bool `json:"two_factor"`
+	}{copyUser, user.HasTwoFactor()})
 }
 
-func UpdateAccountHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) UpdateAccountHandler(w http.ResponseWriter, r *http.Request) {
 	session, err := GetSession(r)
 	if err != nil {
 		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	user, ok := session.Get("USER").(*models.User)
-	if !ok {
-		sendErrorResp(w, "on founding a user's object in the session", http.StatusInternalServerError)
+	user, err := GetUserFromSession(r)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -149,38 +194,142 @@ func UpdateAccountHandler(w http.ResponseWriter, r *http.Request) {
 		sendErrorResp(w, "on decoding a request body", http.StatusBadRequest)
 		return
 	}
-	if err := newUser.ValidateUpdateForm(r.Context()); err != nil {
+	newUser.ID = user.ID
+	if err := newUser.ValidateUpdateForm(r.Context(), s.users); err != nil {
 		sendErrorResp(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	newUser.ID = user.ID
-	if err := newUser.Update(r.Context()); err != nil {
+	newUser.Role = "" // roles are changed by admins only
+	if err := newUser.HashPassword(); err != nil {
 		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	// Putting new user's data back to the session
-	user.Assign(newUser)
-	if err := session.Set("USER", user); err != nil {
-		sendErrorResp(w, "on saving a user's object into session: "+err.Error(), http.StatusInternalServerError)
+	if err := s.users.Update(r.Context(), newUser); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	// A new password ends the old session, so anyone who might have got it is logged out
+	if newUser.Password != "" {
+		if _, err = s.regenerateSession(w, r, session); err != nil {
+			sendErrorResp(w, "on regenerating a session: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
 	sendSuccessResp(w, nil)
 }
 
-func DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+// SetRoleHandler changes the role of the user with the given name: {"role": "editor"}
+func (s *Server) SetRoleHandler(w http.ResponseWriter, r *http.Request) {
+	admin, err := GetUserFromSession(r)
+	if err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user, err := s.users.GetByName(r.Context(), mux.Vars(r)["name"])
+	if err != nil {
+		sendErrorResp(w, "on founding the user", http.StatusNotFound)
+		return
+	}
+	if user.ID == admin.ID {
+		sendErrorResp(w, "on changing the role of your own account", http.StatusForbidden)
+		return
+	}
+	body := struct {
+		Role string `json:"role"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendErrorResp(w, "on decoding a request body", http.StatusBadRequest)
+		return
+	}
+	if err := models.ValidateRole(body.Role); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// The sessions & API tokens of the user are revoked, so a demoted user doesn't keep the old permissions
+	update := &models.User{ID: user.ID, Role: body.Role, SessionsValidFrom: time.Now().UnixNano()}
+	if err := s.users.Update(r.Context(), update); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.tokens.DeleteByUser(r.Context(), user.ID); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sendSuccessResp(w, nil)
+}
+
+func (s *Server) DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
 	user, err := GetUserFromSession(r)
 	if err != nil {
 		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if err := models.DeleteUserByID(r.Context(), user.ID); err != nil {
+	if err := s.users.DeleteByID(r.Context(), user.ID); err != nil {
+		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.tokens.DeleteByUser(r.Context(), user.ID); err != nil {
 		sendErrorResp(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	http.Redirect(w, r, "/api/account/logout", http.StatusSeeOther)
 }
 
+// logIn puts the ID of the user into the session along with the time of logging in,
+// the session is valid until the user's sessions are revoked after that time
+func (s *Server) logIn(r *http.Request, sess session.Session, user *models.User) error {
+	if err := sess.Set("AUTH_TIME", time.Now().UnixNano()); err != nil {
+		return err
+	}
+	if err := sess.Set("USER_ID", user.ID); err != nil {
+		return err
+	}
+	return s.bindSession(r, sess, user.ID)
+}
+
+// bindSession records the device of the request, so the user can see the session among the active ones.
+// Sessions of requests authorized by API tokens last for the request only, so they are left out
+func (s *Server) bindSession(r *http.Request, sess session.Session, userID primitive.ObjectID) error {
+	if _, ok := sess.(requestSession); ok {
+		return nil
+	}
+	manager, err := getManager(r)
+	if err != nil {
+		return err
+	}
+	return manager.Bind(sess, userID.Hex(), session.Device{UserAgent: r.UserAgent(), IP: s.clientAddr(r)})
+}
+
+// regenerateSession moves the values of sess into a session with a new ID, see session.Manager.Regenerate
+func (s *Server) regenerateSession(w http.ResponseWriter, r *http.Request, sess session.Session) (session.Session, error) {
+	if _, ok := sess.(requestSession); ok {
+		return sess, nil
+	}
+	manager, err := getManager(r)
+	if err != nil {
+		return nil, err
+	}
+	fresh, err := manager.Regenerate(w, sess)
+	if err != nil {
+		return nil, err
+	}
+	if userID, ok := fresh.Get("USER_ID").(primitive.ObjectID); ok {
+		if err := s.bindSession(r, fresh, userID); err != nil {
+			return nil, err
+		}
+	}
+	return fresh, nil
+}
+
+func getManager(r *http.Request) (*session.Manager, error) {
+	manager, ok := r.Context().Value("manager").(*session.Manager)
+	if !ok {
+		return nil, errors.New("on retrieving a manager (*session.Manager) from a request's context")
+	}
+	return manager, nil
+}
+
 func GetSession(r *http.Request) (session.Session, error) {
 	session, ok := r.Context().Value("session").(session.Session)
 	if !ok {
@@ -189,14 +338,11 @@ func GetSession(r *http.Request) (session.Session, error) {
 	return session, nil
 }
 
+// GetUserFromSession returns the account logged in the session, which the middleware loads on every request
 func GetUserFromSession(r *http.Request) (*models.User, error) {
-	session, err := GetSession(r)
-	if err != nil {
-		return nil, err
-	}
-	user, ok := session.Get("USER").(*models.User)
+	user, ok := r.Context().Value("user").(*models.User)
 	if !ok {
-		return nil, errors.New("on founding a user's object in the session")
+		return nil, errors.New("on founding the user logged in the session")
 	}
 	return user, nil
 }
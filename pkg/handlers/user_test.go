@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/meddion/web-blog/pkg/models"
+	"github.com/meddion/web-blog/pkg/models/memory"
+)
+
+func TestSetRoleHandler(t *testing.T) {
+	stores := memory.NewStores()
+	srv := NewServer(stores, Options{})
+	m := NewSessionAuthMiddleware(nil, stores.Users, stores.Tokens)
+	admin := &models.User{Name: "admin", Password: "hash", Role: models.RoleAdmin}
+	user := &models.User{Name: "bob", Password: "hash", Role: models.RoleAdmin}
+	for _, u := range []*models.User{admin, user} {
+		if err := stores.Users.Create(context.TODO(), u); err != nil {
+			t.Fatalf("on creating a user: %s", err.Error())
+		}
+	}
+	session := newRequestSession()
+	if err := srv.logIn(httptest.NewRequest("POST", "/api/account/login", nil), session, user); err != nil {
+		t.Fatalf("on logging in: %s", err.Error())
+	}
+	apiToken, _, err := models.NewAPIToken(user.ID, "ci", []string{models.ScopePostsWrite}, time.Hour)
+	if err != nil {
+		t.Fatalf("on making an API token: %s", err.Error())
+	}
+	if err := stores.Tokens.Create(context.TODO(), apiToken); err != nil {
+		t.Fatalf("on creating an API token: %s", err.Error())
+	}
+
+	r := httptest.NewRequest("PUT", "/api/account/bob/role", strings.NewReader(`{"role":"reader"}`))
+	r = mux.SetURLVars(withUser(r, admin), map[string]string{"name": "bob"})
+	rec := httptest.NewRecorder()
+	srv.SetRoleHandler(rec, r)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("on demoting the user expected code %d, instead we got: %d (%s)", http.StatusAccepted, rec.Code, rec.Body.String())
+	}
+
+	if got, err := m.loadUser(context.TODO(), session); err != nil || got != nil {
+		t.Fatalf("expected the session of the demoted user to be logged out, instead we got: %v (%v)", got, err)
+	}
+	if tokens, err := stores.Tokens.ListByUser(context.TODO(), user.ID); err != nil || len(tokens) != 0 {
+		t.Fatalf("expected the API tokens of the demoted user to be revoked, instead we got: %v (%v)", tokens, err)
+	}
+	if got, err := stores.Users.GetByID(context.TODO(), user.ID); err != nil || got.Role != models.RoleReader {
+		t.Fatalf("expected the user to be a reader, instead we got: %v (%v)", got, err)
+	}
+}
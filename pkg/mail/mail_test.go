@@ -0,0 +1,59 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriterMailer(t *testing.T) {
+	var buf bytes.Buffer
+	m := &WriterMailer{W: &buf, From: "blog@localhost"}
+	err := m.Send(context.TODO(), &Message{
+		To:      "alice@example.com\r\nBcc: eve@example.com",
+		Subject: "Hi",
+		Body:    "line 1\nline 2",
+	})
+	if err != nil {
+		t.Fatalf("on sending a message: %s", err.Error())
+	}
+	got := buf.String()
+	if strings.Contains(got, "\r\nBcc:") {
+		t.Fatalf("on letting a header be injected: %q", got)
+	}
+	if !strings.Contains(got, "Subject: Hi\r\n") || !strings.Contains(got, "\r\n\r\nline 1\r\nline 2") {
+		t.Fatalf("on formatting the message: %q", got)
+	}
+}
+
+func TestSMTPMailerTimeout(t *testing.T) {
+	// A server which accepts connections but never greets
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	m := &SMTPMailer{Addr: l.Addr().String(), From: "blog@localhost"}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := m.Send(ctx, &Message{To: "alice@example.com"}); err == nil {
+		t.Fatal("expected sending to a stuck SMTP server to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected sending to give up once the context is done, instead it took %s", elapsed)
+	}
+}
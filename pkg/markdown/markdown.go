@@ -0,0 +1,169 @@
+// Package markdown renders Markdown content of posts into HTML which is safe to show to readers
+package markdown
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Heading is an entry of a table of contents
+type Heading struct {
+	Level int    `json:"level" bson:"level"`
+	Text  string `json:"text" bson:"text"`
+	ID    string `json:"id" bson:"id"`
+}
+
+// The renderer isn't configured with html.WithUnsafe(), so any raw HTML (<script>, <iframe>,
+// inline event handlers, etc.) is left out of the output, while urlSanitizer drops links
+// which could run scripts. Fenced code blocks get "language-*" classes for highlighters
+var md = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(
+		parser.WithAutoHeadingID(),
+		parser.WithASTTransformers(util.Prioritized(urlSanitizer{}, 100)),
+	),
+)
+
+// Render converts Markdown source into sanitized HTML
+// & returns it along with the table of contents made of source's headings
+func Render(source string) (string, []Heading, error) {
+	src := []byte(source)
+	doc := md.Parser().Parse(text.NewReader(src), parser.WithContext(parser.NewContext(parser.WithIDs(newIDs()))))
+
+	var buf bytes.Buffer
+	if err := md.Renderer().Render(&buf, src, doc); err != nil {
+		return "", nil, err
+	}
+	return buf.String(), tableOfContents(doc, src), nil
+}
+
+func tableOfContents(doc ast.Node, source []byte) []Heading {
+	toc := make([]Heading, 0)
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		var id string
+		if v, ok := heading.AttributeString("id"); ok {
+			if b, ok := v.([]byte); ok {
+				id = string(b)
+			}
+		}
+		toc = append(toc, Heading{
+			Level: heading.Level,
+			Text:  string(heading.Text(source)),
+			ID:    id,
+		})
+		return ast.WalkSkipChildren, nil
+	})
+	return toc
+}
+
+// ids generates unique anchors of headings out of their text
+type ids struct {
+	used map[string]struct{}
+}
+
+func newIDs() *ids {
+	return &ids{used: make(map[string]struct{})}
+}
+
+func (s *ids) Generate(value []byte, kind ast.NodeKind) []byte {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(string(value)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(r)
+			continue
+		}
+		dash = true
+	}
+	base := b.String()
+	if base == "" {
+		base = "section"
+	}
+	id := base
+	for i := 1; ; i++ {
+		if _, ok := s.used[id]; !ok {
+			break
+		}
+		id = base + "-" + strconv.Itoa(i)
+	}
+	s.used[id] = struct{}{}
+	return []byte(id)
+}
+
+func (s *ids) Put(value []byte) {
+	s.used[string(value)] = struct{}{}
+}
+
+// urlSanitizer drops destinations of links & images with schemes other than http(s) & mailto,
+// autolinks with such schemes are turned into plain text
+type urlSanitizer struct{}
+
+func (urlSanitizer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var unsafe []*ast.AutoLink
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Link:
+			if !isSafeDestination(n.Destination) {
+				n.Destination = nil
+			}
+		case *ast.Image:
+			if !isSafeDestination(n.Destination) {
+				n.Destination = nil
+			}
+		case *ast.AutoLink:
+			if !isSafeDestination(n.URL(source)) {
+				unsafe = append(unsafe, n)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	for _, n := range unsafe {
+		n.Parent().ReplaceChild(n.Parent(), n, ast.NewString(n.Label(source)))
+	}
+}
+
+// isSafeDestination checks a destination the way it's going to be rendered, with references resolved
+func isSafeDestination(dest []byte) bool {
+	return IsSafeURL(string(util.URLEscape(dest, true)))
+}
+
+// IsSafeURL reports whether url is relative or has http, https or mailto scheme
+func IsSafeURL(url string) bool {
+	// Browsers ignore control chars & spaces in schemes, so should we
+	url = strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, url)
+	i := strings.IndexAny(url, ":/?#")
+	if i < 0 || url[i] != ':' {
+		return true
+	}
+	switch strings.ToLower(url[:i]) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package markdown
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRenderStripsUnsafeContent(t *testing.T) {
+	cases := []string{
+		"<script>alert(1)</script>",
+		"text <img src=x onerror=alert(1)> <iframe src=x></iframe>",
+		"[x](JavaScript:alert(1))",
+		"[x](&#106;avascript:alert(1))",
+		"![x](javascript:alert(1))",
+		"<JAVASCRIPT:alert(1)>",
+		"[a]: vbscript:alert(1)\n\n[link][a]",
+		"```go\"><script>\ncode\n```",
+	}
+	for _, c := range cases {
+		html, _, err := Render(c)
+		if err != nil {
+			t.Fatalf("on rendering %q: %s", c, err.Error())
+		}
+		lower := strings.ToLower(html)
+		for _, bad := range []string{"<script", "<iframe", "onerror", `href="javascript`, `href="vbscript`, `src="javascript`} {
+			if strings.Contains(lower, bad) {
+				t.Fatalf("with input %q the output contains %q: %s", c, bad, html)
+			}
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	source := "# Intro\n\n[link](https://example.com)\n\n## Intro\n\n```go\nfmt.Println()\n```\n\n### Привіт, світ!\n"
+	html, toc, err := Render(source)
+	if err != nil {
+		t.Fatalf("on rendering: %s", err.Error())
+	}
+	for _, expected := range []string{
+		`<h1 id="intro">Intro</h1>`,
+		`<h2 id="intro-1">Intro</h2>`,
+		`<a href="https://example.com">link</a>`,
+		`<code class="language-go">`,
+	} {
+		if !strings.Contains(html, expected) {
+			t.Fatalf("expected the output to contain %q, instead we got: %s", expected, html)
+		}
+	}
+	expectedTOC := []Heading{
+		{1, "Intro", "intro"},
+		{2, "Intro", "intro-1"},
+		{3, "Привіт, світ!", "привіт-світ"},
+	}
+	if !reflect.DeepEqual(toc, expectedTOC) {
+		t.Fatalf("expected the table of contents %v, instead we got: %v", expectedTOC, toc)
+	}
+}
@@ -0,0 +1,199 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collNameComment = "comments"
+
+// Statuses of comments, only approved ones are shown to readers
+const (
+	CommentPending  = "pending"
+	CommentApproved = "approved"
+	CommentSpam     = "spam"
+)
+
+const (
+	maxCommentLen    = 5000
+	maxCommenterName = 50
+	anonymousName    = "Anonymous"
+)
+
+// Comment is a reader's comment on a post, ParentID is set for replies to other comments
+type Comment struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	PostID       primitive.ObjectID `json:"post_id" bson:"post_id"`
+	ParentID     primitive.ObjectID `json:"parent_id" bson:"parent_id"`
+	AuthorName   string             `json:"author_name" bson:"author_name"`
+	UserID       primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Content      string             `json:"content" bson:"content"`
+	Status       string             `json:"status" bson:"status"`
+	CreationTime int64              `json:"creation_time" bson:"creation_time"`
+}
+
+// CommentFilter narrows down the comments to be counted or listed, zero fields match any comment
+type CommentFilter struct {
+	PostID primitive.ObjectID
+	Status string
+}
+
+// Matches reports whether c passes the filter
+func (f CommentFilter) Matches(c *Comment) bool {
+	if !f.PostID.IsZero() && c.PostID != f.PostID {
+		return false
+	}
+	if f.Status != "" && c.Status != f.Status {
+		return false
+	}
+	return true
+}
+
+func (f CommentFilter) bson() bson.M {
+	filter := bson.M{}
+	if !f.PostID.IsZero() {
+		filter["post_id"] = f.PostID
+	}
+	if f.Status != "" {
+		filter["status"] = f.Status
+	}
+	return filter
+}
+
+// CommentsQuery describes a page of comments to be listed, comments go from the oldest to the newest
+type CommentsQuery struct {
+	Filter   CommentFilter
+	PageSize int64
+	PageNum  int64
+}
+
+// Skip returns the number of comments preceding the requested page
+func (q CommentsQuery) Skip() int64 {
+	return (q.PageNum - 1) * q.PageSize
+}
+
+// ValidateCommentStatus checks a status set by a moderator
+func ValidateCommentStatus(status string) error {
+	switch status {
+	case CommentPending, CommentApproved, CommentSpam:
+		return nil
+	}
+	return errors.New("on receiving an unknown comment status")
+}
+
+// Validate checks a new comment & fills the name of anonymous commenters
+func (c *Comment) Validate() error {
+	c.Content = strings.TrimSpace(c.Content)
+	c.AuthorName = strings.TrimSpace(c.AuthorName)
+	if c.Content == "" {
+		return errors.New("on receiving an empty comment")
+	}
+	if utf8.RuneCountInString(c.Content) > maxCommentLen {
+		return errors.New("on receiving a comment which is too long")
+	}
+	if utf8.RuneCountInString(c.AuthorName) > maxCommenterName {
+		return errors.New("on receiving a commenter name which is too long")
+	}
+	if c.AuthorName == "" {
+		c.AuthorName = anonymousName
+	}
+	return nil
+}
+
+type mongoCommentStore struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoCommentStore) Create(ctx context.Context, c *Comment) error {
+	c.CreationTime = time.Now().Unix()
+	result, err := s.coll.InsertOne(ctx, c)
+	if err != nil {
+		return err
+	}
+	if objectID, ok := result.InsertedID.(primitive.ObjectID); ok {
+		c.ID = objectID
+		return nil
+	}
+	return errors.New("on retrieving undefined id type")
+}
+
+func (s *mongoCommentStore) GetByID(ctx context.Context, id string) (*Comment, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	comment := &Comment{}
+	if err := s.coll.FindOne(ctx, bson.M{"_id": objectID}).Decode(comment); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return comment, nil
+}
+
+func (s *mongoCommentStore) Count(ctx context.Context, filter CommentFilter) (int64, error) {
+	return s.coll.CountDocuments(ctx, filter.bson())
+}
+
+func (s *mongoCommentStore) List(ctx context.Context, q CommentsQuery) ([]*Comment, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "creation_time", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(q.Skip()).
+		SetLimit(q.PageSize)
+	cur, err := s.coll.Find(ctx, q.Filter.bson(), opts)
+	if err != nil {
+		return nil, err
+	}
+	comments := make([]*Comment, 0)
+	if err := cur.All(ctx, &comments); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (s *mongoCommentStore) SetStatus(ctx context.Context, id primitive.ObjectID, status string) error {
+	result, err := s.coll.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"status": status}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoCommentStore) DeleteByID(ctx context.Context, id primitive.ObjectID) error {
+	// Collecting the replies level by level
+	ids := []primitive.ObjectID{id}
+	for level := ids; len(level) > 0; {
+		cur, err := s.coll.Find(ctx, bson.M{"parent_id": bson.M{"$in": level}}, options.Find().SetProjection(bson.M{"_id": 1}))
+		if err != nil {
+			return err
+		}
+		var replies []*Comment
+		if err := cur.All(ctx, &replies); err != nil {
+			return err
+		}
+		level = nil
+		for _, reply := range replies {
+			level = append(level, reply.ID)
+		}
+		ids = append(ids, level...)
+	}
+	_, err := s.coll.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	return err
+}
+
+func (s *mongoCommentStore) DeleteByPost(ctx context.Context, postID primitive.ObjectID) error {
+	_, err := s.coll.DeleteMany(ctx, bson.M{"post_id": postID})
+	return err
+}
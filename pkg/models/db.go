@@ -2,45 +2,86 @@ package models
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"time"
 
-	"github.com/meddion/web-blog/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var db *mongo.Database
+// codeDuplicateKey is the code of MongoDB errors on violating unique indexes
+const codeDuplicateKey = 11000
 
-func init() {
-	conf := config.GetConf()
-	// Connecting to the DB
-	if err := initDB(conf.Db.URI, conf.Db.Name); err != nil {
-		log.Fatal(err)
-	}
-}
-
-// GetDB returns *mongo.Database instance
-func GetDB() *mongo.Database {
-	return db
-}
-
-// InitDB initializes DB connections
-func initDB(URI, databaseName string) error {
+// ConnectMongo initializes a connection to the DB & returns *mongo.Database instance
+func ConnectMongo(URI, databaseName string) (*mongo.Database, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 	client, err := mongo.Connect(ctx, options.Client().ApplyURI(URI))
 	if err != nil {
-		return fmt.Errorf("on connecting to database endpoint: %s", err.Error())
+		return nil, fmt.Errorf("on connecting to database endpoint: %s", err.Error())
 	}
 
 	ctx, cancel = context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	if err = client.Ping(ctx, nil); err != nil {
-		return fmt.Errorf("on pinging to database endpoint: %s", err.Error())
+		return nil, fmt.Errorf("on pinging to database endpoint: %s", err.Error())
+	}
+
+	return client.Database(databaseName), nil
+}
+
+// NewMongoStores returns stores backed by the given MongoDB database
+func NewMongoStores(db *mongo.Database) *Stores {
+	return &Stores{
+		Posts:     &mongoPostStore{db.Collection(collNamePost)},
+		Users:     &mongoUserStore{db.Collection(collNameUser)},
+		Files:     &mongoFileStore{db.Collection(collNameStatic)},
+		Revisions: &mongoRevisionStore{db.Collection(collNameRevision)},
+		Comments:  &mongoCommentStore{db.Collection(collNameComment)},
+		Invites:   &mongoInviteStore{db.Collection(collNameInvite)},
+		Resets:    &mongoPasswordResetStore{db.Collection(collNamePasswordReset)},
+		Tokens:    &mongoAPITokenStore{db.Collection(collNameAPIToken)},
+		Lockouts:  &mongoLockoutStore{db.Collection(collNameLockout)},
 	}
+}
 
-	db = client.Database(databaseName)
+// CreateIndexes makes the indexes the stores rely on, e.g. the unique ones keeping concurrent writes consistent
+func CreateIndexes(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	revisions := mongo.IndexModel{
+		Keys:    bson.D{{Key: "post_id", Value: 1}, {Key: "rev", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := db.Collection(collNameRevision).Indexes().CreateOne(ctx, revisions); err != nil {
+		return fmt.Errorf("on creating the index of revisions: %s", err.Error())
+	}
+	// Posts made before slugs were introduced have none
+	var slugs []mongo.IndexModel
+	for _, field := range []string{"slug", "old_slugs"} {
+		slugs = append(slugs, mongo.IndexModel{
+			Keys:    bson.M{field: 1},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{field: bson.M{"$exists": true}}),
+		})
+	}
+	if _, err := db.Collection(collNamePost).Indexes().CreateMany(ctx, slugs); err != nil {
+		return fmt.Errorf("on creating the indexes of slugs: %s", err.Error())
+	}
 	return nil
 }
+
+// isDuplicateKey reports whether err is caused by violating a unique index
+func isDuplicateKey(err error) bool {
+	var writeErr mongo.WriteException
+	if errors.As(err, &writeErr) {
+		for _, e := range writeErr.WriteErrors {
+			if e.Code == codeDuplicateKey {
+				return true
+			}
+		}
+	}
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && cmdErr.Code == codeDuplicateKey
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestIsDuplicateKey(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected bool
+	}{
+		{mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: codeDuplicateKey}}}, true},
+		{mongo.CommandError{Code: codeDuplicateKey}, true},
+		{mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 1}}}, false},
+		{errors.New("on failing"), false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		if got := isDuplicateKey(c.err); got != c.expected {
+			t.Fatalf("expected %v to be a duplicate key error: %v, instead we got: %v", c.err, c.expected, got)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collNameInvite = "invites"
+
+const (
+	defaultInviteTTL = 7 * 24 * time.Hour
+	maxInviteTTL     = 90 * 24 * time.Hour
+)
+
+// Invite lets the holder of its token sign up with the given role, up to MaxUses times before ExpiresAt.
+// Only the hash of the token is kept, the token itself is shown once on creation
+type Invite struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TokenHash    string             `json:"-" bson:"token_hash"`
+	Role         string             `json:"role" bson:"role"`
+	MaxUses      int64              `json:"max_uses" bson:"max_uses"`
+	Uses         int64              `json:"uses" bson:"uses"`
+	ExpiresAt    int64              `json:"expires_at" bson:"expires_at"`
+	CreatedBy    primitive.ObjectID `json:"created_by" bson:"created_by"`
+	CreationTime int64              `json:"creation_time" bson:"creation_time"`
+}
+
+// NewInvite returns an invite for role which expires after ttl (7 days if it's zero)
+// along with its token
+func NewInvite(role string, maxUses int64, ttl time.Duration) (*Invite, string, error) {
+	if err := ValidateRole(role); err != nil {
+		return nil, "", err
+	}
+	if maxUses == 0 {
+		maxUses = 1
+	}
+	if maxUses < 0 {
+		return nil, "", errors.New("on receiving a negative number of invite uses")
+	}
+	if ttl == 0 {
+		ttl = defaultInviteTTL
+	}
+	if ttl < 0 || ttl > maxInviteTTL {
+		return nil, "", errors.New("on receiving an invite lifetime which is negative or longer than 90 days")
+	}
+	token, err := NewToken()
+	if err != nil {
+		return nil, "", err
+	}
+	return &Invite{
+		TokenHash: HashToken(token),
+		Role:      role,
+		MaxUses:   maxUses,
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+	}, token, nil
+}
+
+// NewToken returns a random URL-safe secret
+func NewToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hash tokens are looked up by in the storage
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type mongoInviteStore struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoInviteStore) Create(ctx context.Context, inv *Invite) error {
+	inv.CreationTime = time.Now().Unix()
+	result, err := s.coll.InsertOne(ctx, inv)
+	if err != nil {
+		return err
+	}
+	if objectID, ok := result.InsertedID.(primitive.ObjectID); ok {
+		inv.ID = objectID
+		return nil
+	}
+	return errors.New("on retrieving undefined id type")
+}
+
+func (s *mongoInviteStore) List(ctx context.Context) ([]*Invite, error) {
+	cur, err := s.coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"creation_time": -1}))
+	if err != nil {
+		return nil, err
+	}
+	invites := make([]*Invite, 0)
+	if err := cur.All(ctx, &invites); err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+func (s *mongoInviteStore) DeleteByID(ctx context.Context, id primitive.ObjectID) error {
+	result, err := s.coll.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoInviteStore) Use(ctx context.Context, tokenHash string, now int64) (*Invite, error) {
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"expires_at": bson.M{"$gt": now},
+		"$expr":      bson.M{"$lt": bson.A{"$uses", "$max_uses"}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	inv := &Invite{}
+	err := s.coll.FindOneAndUpdate(ctx, filter, bson.M{"$inc": bson.M{"uses": 1}}, opts).Decode(inv)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return inv, nil
+}
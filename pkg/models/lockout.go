@@ -0,0 +1,62 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collNameLockout = "lockouts"
+
+// Kinds of keys locked out after failed logins
+const (
+	LockoutAccount = "account"
+	LockoutAddress = "address"
+)
+
+// Lockout is an audit record of logging in being blocked for a key (account name or client address)
+// after too many failed attempts
+type Lockout struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Kind         string             `json:"kind" bson:"kind"`
+	Key          string             `json:"key" bson:"key"`
+	Address      string             `json:"address" bson:"address"` // the client which made the last attempt
+	Failures     int64              `json:"failures" bson:"failures"`
+	LockedUntil  int64              `json:"locked_until" bson:"locked_until"`
+	CreationTime int64              `json:"creation_time" bson:"creation_time"`
+}
+
+type mongoLockoutStore struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoLockoutStore) Create(ctx context.Context, l *Lockout) error {
+	l.CreationTime = time.Now().Unix()
+	result, err := s.coll.InsertOne(ctx, l)
+	if err != nil {
+		return err
+	}
+	if objectID, ok := result.InsertedID.(primitive.ObjectID); ok {
+		l.ID = objectID
+		return nil
+	}
+	return errors.New("on retrieving undefined id type")
+}
+
+func (s *mongoLockoutStore) List(ctx context.Context, limit int64) ([]*Lockout, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "creation_time", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(limit)
+	cur, err := s.coll.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	lockouts := make([]*Lockout, 0)
+	if err := cur.All(ctx, &lockouts); err != nil {
+		return nil, err
+	}
+	return lockouts, nil
+}
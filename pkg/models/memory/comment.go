@@ -0,0 +1,131 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type commentStore struct {
+	*Store
+}
+
+func (s *commentStore) Create(ctx context.Context, c *models.Comment) error {
+	c.CreationTime = time.Now().Unix()
+	c.ID = primitive.NewObjectID()
+	return s.write(func(d *data) error {
+		comment := *c
+		d.Comments[c.ID.Hex()] = &comment
+		d.touch("Comments", c.ID.Hex())
+		return nil
+	})
+}
+
+func (s *commentStore) GetByID(ctx context.Context, id string) (*models.Comment, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	var comment *models.Comment
+	err = s.read(func(d *data) error {
+		c, ok := d.Comments[objectID.Hex()]
+		if !ok {
+			return models.ErrNotFound
+		}
+		copied := *c
+		comment = &copied
+		return nil
+	})
+	return comment, err
+}
+
+func (s *commentStore) Count(ctx context.Context, filter models.CommentFilter) (int64, error) {
+	var n int64
+	s.read(func(d *data) error {
+		for _, c := range d.Comments {
+			if filter.Matches(c) {
+				n++
+			}
+		}
+		return nil
+	})
+	return n, nil
+}
+
+func (s *commentStore) List(ctx context.Context, q models.CommentsQuery) ([]*models.Comment, error) {
+	var matched []*models.Comment
+	s.read(func(d *data) error {
+		for _, c := range d.Comments {
+			if q.Filter.Matches(c) {
+				comment := *c
+				matched = append(matched, &comment)
+			}
+		}
+		return nil
+	})
+	// Object IDs grow with time, so they break ties of comments made within a second
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].CreationTime != matched[j].CreationTime {
+			return matched[i].CreationTime < matched[j].CreationTime
+		}
+		return matched[i].ID.Hex() < matched[j].ID.Hex()
+	})
+	comments := make([]*models.Comment, 0)
+	skip := q.Skip()
+	if skip < 0 || skip >= int64(len(matched)) {
+		return comments, nil
+	}
+	matched = matched[skip:]
+	if int64(len(matched)) > q.PageSize {
+		matched = matched[:q.PageSize]
+	}
+	return append(comments, matched...), nil
+}
+
+func (s *commentStore) SetStatus(ctx context.Context, id primitive.ObjectID, status string) error {
+	return s.write(func(d *data) error {
+		c, ok := d.Comments[id.Hex()]
+		if !ok {
+			return models.ErrNotFound
+		}
+		c.Status = status
+		d.touch("Comments", id.Hex())
+		return nil
+	})
+}
+
+func (s *commentStore) DeleteByID(ctx context.Context, id primitive.ObjectID) error {
+	return s.write(func(d *data) error {
+		if _, ok := d.Comments[id.Hex()]; !ok {
+			return models.ErrNotFound
+		}
+		deleteThread(d, id)
+		return nil
+	})
+}
+
+// deleteThread removes the comment with the given ID & replies to it recursively
+func deleteThread(d *data, id primitive.ObjectID) {
+	delete(d.Comments, id.Hex())
+	d.touch("Comments", id.Hex())
+	for _, c := range d.Comments {
+		if c.ParentID == id {
+			deleteThread(d, c.ID)
+		}
+	}
+}
+
+func (s *commentStore) DeleteByPost(ctx context.Context, postID primitive.ObjectID) error {
+	return s.write(func(d *data) error {
+		for id, c := range d.Comments {
+			if c.PostID == postID {
+				delete(d.Comments, id)
+				d.touch("Comments", id)
+			}
+		}
+		return nil
+	})
+}
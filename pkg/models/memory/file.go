@@ -0,0 +1,284 @@
+package memory
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/models"
+)
+
+// The data file starts with magic followed by entries: the first one holds all the data as of the last compaction,
+// every next one the records changed by a write; each entry is framed by its length & CRC-32 checksum
+const magic = "web-blog data v2\n"
+
+// minCompactSize is the size of entries appended since the last compaction the data file is compacted after at least,
+// it's compacted once they outgrow the first entry as well
+const minCompactSize = 1 << 20
+
+// entry is a change of data saved to the data file
+type entry struct {
+	Set     *data               // the records which are set, by their collections
+	Deleted map[string][]string // the keys of records which are deleted by the names of their collections
+}
+
+// Open returns a Store persisted to the file at path,
+// the data saved there before (if any) is loaded
+func Open(path string) (*Store, error) {
+	s := &Store{data: newData(), path: path}
+	s.data.changed = make(map[string]map[string]bool)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	s.file = f
+	head := make([]byte, len(magic))
+	if _, err := io.ReadFull(f, head); err == io.EOF {
+		return s, s.compact()
+	} else if err != nil && err != io.ErrUnexpectedEOF {
+		f.Close()
+		return nil, err
+	}
+	if string(head) != magic {
+		// The whole data was encoded at once by earlier versions
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if err := gob.NewDecoder(f).Decode(s.data); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("on decoding the data file %s: %s", path, err.Error())
+		}
+		s.data.init()
+		return s, s.compact()
+	}
+	if err := s.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("on decoding the data file %s: %s", path, err.Error())
+	}
+	return s, nil
+}
+
+// OpenStores returns models' stores backed by the file at path
+func OpenStores(path string) (*models.Stores, error) {
+	s, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return s.Stores(), nil
+}
+
+// load applies the entries of the data file following magic,
+// an entry which is cut short (e.g. by a crash while it was appended) is dropped along with the rest of the file
+func (s *Store) load() error {
+	r := bufio.NewReader(s.file)
+	offset := int64(len(magic))
+	for first := true; ; first = false {
+		e, n, err := readEntry(r)
+		if err == io.EOF {
+			break
+		} else if err == errTornEntry {
+			log.Printf("Dropping %s of the data file cut short at %d bytes", s.path, offset)
+			if err := s.file.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		} else if err != nil {
+			return err
+		}
+		s.data.apply(e)
+		offset += n
+		if first {
+			s.compacted = offset
+		}
+	}
+	s.size = offset
+	s.data.init()
+	_, err := s.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+var errTornEntry = errors.New("on reading an entry which is cut short")
+
+// readEntry reads an entry from r returning the number of bytes it takes
+func readEntry(r io.Reader) (*entry, int64, error) {
+	var frame [8]byte
+	if n, err := io.ReadFull(r, frame[:]); err == io.EOF {
+		return nil, 0, io.EOF
+	} else if err == io.ErrUnexpectedEOF || (err == nil && n < len(frame)) {
+		return nil, 0, errTornEntry
+	} else if err != nil {
+		return nil, 0, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint32(frame[:4]))
+	if _, err := io.ReadFull(r, buf); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, 0, errTornEntry
+	} else if err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(buf) != binary.BigEndian.Uint32(frame[4:]) {
+		return nil, 0, errTornEntry
+	}
+	e := &entry{}
+	if err := gob.NewDecoder(bytes.NewReader(buf)).Decode(e); err != nil {
+		return nil, 0, err
+	}
+	return e, int64(len(frame) + len(buf)), nil
+}
+
+// encodeEntry returns e framed to be appended to the data file
+func encodeEntry(e *entry) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 8))
+	if err := gob.NewEncoder(&buf).Encode(e); err != nil {
+		return nil, fmt.Errorf("on encoding the data: %s", err.Error())
+	}
+	b := buf.Bytes()
+	binary.BigEndian.PutUint32(b[:4], uint32(len(b)-8))
+	binary.BigEndian.PutUint32(b[4:8], crc32.ChecksumIEEE(b[8:]))
+	return b, nil
+}
+
+// persist appends the records changed since data was persisted last to the data file,
+// which is compacted once the appended entries outgrow it; the caller must hold a write lock
+func (s *Store) persist() error {
+	if s.path == "" || len(s.data.changed) == 0 {
+		return nil
+	}
+	b, err := encodeEntry(s.data.changes())
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(b); err == nil {
+		err = s.file.Sync()
+	}
+	if err != nil {
+		// Dropping whatever part of the entry was written, so the next ones aren't appended after it
+		if truncErr := s.file.Truncate(s.size); truncErr != nil {
+			log.Printf("on truncating the data file: %s", truncErr.Error())
+		}
+		s.file.Seek(s.size, io.SeekStart)
+		return err
+	}
+	s.size += int64(len(b))
+	s.data.changed = make(map[string]map[string]bool)
+	s.dirty, s.persisted = false, time.Now()
+	if appended := s.size - s.compacted; appended > minCompactSize && appended > s.compacted {
+		return s.compact()
+	}
+	return nil
+}
+
+// compact atomically replaces the data file with a single entry holding all the data,
+// the caller must hold a write lock
+func (s *Store) compact() error {
+	b, err := encodeEntry(&entry{Set: s.data})
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(magic); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		tmp.Close()
+		return err
+	}
+	s.file.Close()
+	s.file = tmp
+	s.size = int64(len(magic) + len(b))
+	s.compacted = s.size
+	s.data.changed = make(map[string]map[string]bool)
+	s.dirty, s.persisted = false, time.Now()
+	return nil
+}
+
+// touch marks the records of collection (the name of a field of data) with keys as changed,
+// so they are persisted along with the write; every write has to touch the records it sets or deletes
+func (d *data) touch(collection string, keys ...string) {
+	if d.changed == nil {
+		return
+	}
+	if d.changed[collection] == nil {
+		d.changed[collection] = make(map[string]bool)
+	}
+	for _, key := range keys {
+		d.changed[collection][key] = true
+	}
+}
+
+// changes returns the entry of the records touched since data was persisted last
+func (d *data) changes() *entry {
+	e := &entry{Set: newData(), Deleted: make(map[string][]string)}
+	for collection, keys := range d.changed {
+		from, to := d.collection(collection), e.Set.collection(collection)
+		for key := range keys {
+			k := reflect.ValueOf(key)
+			if v := from.MapIndex(k); v.IsValid() {
+				to.SetMapIndex(k, v)
+			} else {
+				e.Deleted[collection] = append(e.Deleted[collection], key)
+			}
+		}
+	}
+	return e
+}
+
+// apply changes d by e
+func (d *data) apply(e *entry) {
+	if e.Set != nil {
+		set := reflect.ValueOf(e.Set).Elem()
+		for i := 0; i < set.NumField(); i++ {
+			from := set.Field(i)
+			if from.Kind() != reflect.Map || from.IsNil() {
+				continue
+			}
+			to := reflect.ValueOf(d).Elem().Field(i)
+			if to.IsNil() {
+				to.Set(reflect.MakeMap(to.Type()))
+			}
+			for _, key := range from.MapKeys() {
+				to.SetMapIndex(key, from.MapIndex(key))
+			}
+		}
+	}
+	for collection, keys := range e.Deleted {
+		m := d.collection(collection)
+		for _, key := range keys {
+			m.SetMapIndex(reflect.ValueOf(key), reflect.Value{})
+		}
+	}
+}
+
+// collection returns the map of d with the name of the field
+func (d *data) collection(name string) reflect.Value {
+	m := reflect.ValueOf(d).Elem().FieldByName(name)
+	if m.Kind() != reflect.Map {
+		panic("memory: unknown collection " + name)
+	}
+	return m
+}
@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type inviteStore struct {
+	*Store
+}
+
+func (s *inviteStore) Create(ctx context.Context, inv *models.Invite) error {
+	inv.CreationTime = time.Now().Unix()
+	inv.ID = primitive.NewObjectID()
+	return s.write(func(d *data) error {
+		invite := *inv
+		d.Invites[inv.ID.Hex()] = &invite
+		d.touch("Invites", inv.ID.Hex())
+		return nil
+	})
+}
+
+func (s *inviteStore) List(ctx context.Context) ([]*models.Invite, error) {
+	invites := make([]*models.Invite, 0)
+	s.read(func(d *data) error {
+		for _, inv := range d.Invites {
+			invite := *inv
+			invites = append(invites, &invite)
+		}
+		return nil
+	})
+	sort.Slice(invites, func(i, j int) bool { return invites[i].ID.Hex() > invites[j].ID.Hex() })
+	return invites, nil
+}
+
+func (s *inviteStore) DeleteByID(ctx context.Context, id primitive.ObjectID) error {
+	return s.write(func(d *data) error {
+		if _, ok := d.Invites[id.Hex()]; !ok {
+			return models.ErrNotFound
+		}
+		delete(d.Invites, id.Hex())
+		d.touch("Invites", id.Hex())
+		return nil
+	})
+}
+
+func (s *inviteStore) Use(ctx context.Context, tokenHash string, now int64) (*models.Invite, error) {
+	var invite *models.Invite
+	err := s.write(func(d *data) error {
+		for _, inv := range d.Invites {
+			if inv.TokenHash == tokenHash && inv.ExpiresAt > now && inv.Uses < inv.MaxUses {
+				inv.Uses++
+				d.touch("Invites", inv.ID.Hex())
+				copied := *inv
+				invite = &copied
+				return nil
+			}
+		}
+		return models.ErrNotFound
+	})
+	return invite, err
+}
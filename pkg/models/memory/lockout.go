@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type lockoutStore struct {
+	*Store
+}
+
+func (s *lockoutStore) Create(ctx context.Context, l *models.Lockout) error {
+	l.CreationTime = time.Now().Unix()
+	l.ID = primitive.NewObjectID()
+	return s.write(func(d *data) error {
+		copied := *l
+		d.Lockouts[l.ID.Hex()] = &copied
+		d.touch("Lockouts", l.ID.Hex())
+		return nil
+	})
+}
+
+func (s *lockoutStore) List(ctx context.Context, limit int64) ([]*models.Lockout, error) {
+	lockouts := make([]*models.Lockout, 0)
+	s.read(func(d *data) error {
+		for _, l := range d.Lockouts {
+			copied := *l
+			lockouts = append(lockouts, &copied)
+		}
+		return nil
+	})
+	sort.Slice(lockouts, func(i, j int) bool {
+		if lockouts[i].CreationTime != lockouts[j].CreationTime {
+			return lockouts[i].CreationTime > lockouts[j].CreationTime
+		}
+		return lockouts[i].ID.Hex() > lockouts[j].ID.Hex()
+	})
+	if int64(len(lockouts)) > limit {
+		lockouts = lockouts[:limit]
+	}
+	return lockouts, nil
+}
@@ -0,0 +1,293 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/markdown"
+	"github.com/meddion/web-blog/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type postStore struct {
+	*Store
+}
+
+func (s *postStore) Save(ctx context.Context, p *models.Post) error {
+	p.CreationTime = time.Now().Unix()
+	p.ID = primitive.NewObjectID()
+	return s.write(func(d *data) error {
+		if slugTaken(d, p) {
+			return models.ErrSlugTaken
+		}
+		d.Posts[p.ID.Hex()] = copyPost(p)
+		d.touch("Posts", p.ID.Hex())
+		return nil
+	})
+}
+
+// Update mirrors $set of the Mongo store: zero ID, author & times are left untouched
+func (s *postStore) Update(ctx context.Context, p *models.Post) error {
+	p.LastEdited = time.Now().Unix()
+	return s.write(func(d *data) error {
+		post, ok := d.Posts[p.ID.Hex()]
+		if !ok {
+			return models.ErrNotFound
+		}
+		if slugTaken(d, p) {
+			return models.ErrSlugTaken
+		}
+		d.touch("Posts", p.ID.Hex())
+		post.Title = p.Title
+		post.Content = p.Content
+		post.ContentHTML = p.ContentHTML
+		post.TOC = append([]markdown.Heading(nil), p.TOC...)
+		post.Tags = append([]string(nil), p.Tags...)
+		post.LastEdited = p.LastEdited
+		if p.Slug != "" {
+			post.Slug = p.Slug
+		}
+		if len(p.OldSlugs) > 0 {
+			post.OldSlugs = append([]string(nil), p.OldSlugs...)
+		}
+		if p.Status != "" {
+			post.Status = p.Status
+		}
+		if p.PublishAt != 0 {
+			post.PublishAt = p.PublishAt
+		}
+		if p.PublishedAt != 0 {
+			post.PublishedAt = p.PublishedAt
+		}
+		if !p.AuthorID.IsZero() {
+			post.AuthorID = p.AuthorID
+		}
+		if !p.EditorID.IsZero() {
+			post.EditorID = p.EditorID
+		}
+		if p.CreationTime != 0 {
+			post.CreationTime = p.CreationTime
+		}
+		return nil
+	})
+}
+
+func (s *postStore) DeleteByID(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	return s.write(func(d *data) error {
+		if _, ok := d.Posts[objectID.Hex()]; !ok {
+			return models.ErrNotFound
+		}
+		delete(d.Posts, objectID.Hex())
+		d.touch("Posts", objectID.Hex())
+		return nil
+	})
+}
+
+func (s *postStore) GetByID(ctx context.Context, id string) (*models.Post, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	var post *models.Post
+	err = s.read(func(d *data) error {
+		p, ok := d.Posts[objectID.Hex()]
+		if !ok {
+			return models.ErrNotFound
+		}
+		post = copyPost(p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+func (s *postStore) GetBySlug(ctx context.Context, slug string) (*models.Post, error) {
+	var post *models.Post
+	err := s.read(func(d *data) error {
+		for _, p := range d.Posts {
+			if hasSlug(p, slug) {
+				post = copyPost(p)
+				return nil
+			}
+		}
+		return models.ErrNotFound
+	})
+	return post, err
+}
+
+func (s *postStore) SlugTaken(ctx context.Context, slug string, exceptID primitive.ObjectID) (taken bool, err error) {
+	err = s.read(func(d *data) error {
+		for _, p := range d.Posts {
+			if p.ID != exceptID && hasSlug(p, slug) {
+				taken = true
+				break
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func (s *postStore) Count(ctx context.Context, filter models.PostFilter) (n int64, err error) {
+	err = s.read(func(d *data) error {
+		for _, p := range d.Posts {
+			if filter.Matches(p) {
+				n++
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func (s *postStore) List(ctx context.Context, q models.PostsQuery) ([]*models.PostWithAuthor, error) {
+	var posts []*models.PostWithAuthor
+	s.read(func(d *data) error {
+		for _, p := range d.Posts {
+			if !q.Filter.Matches(p) {
+				continue
+			}
+			post := &models.PostWithAuthor{Post: *copyPost(p)}
+			if u, ok := d.Users[p.AuthorID.Hex()]; ok {
+				post.Author = models.User{ID: u.ID, Name: u.Name}
+			}
+			posts = append(posts, post)
+		}
+		return nil
+	})
+	sortPosts(posts, q.OldestFirst)
+	return paginate(posts, q), nil
+}
+
+func (s *postStore) Tags(ctx context.Context, filter models.PostFilter) ([]*models.TagCount, error) {
+	counts := make(map[string]int64)
+	s.read(func(d *data) error {
+		for _, p := range d.Posts {
+			if !filter.Matches(p) {
+				continue
+			}
+			for _, tag := range p.Tags {
+				counts[tag]++
+			}
+		}
+		return nil
+	})
+	tags := make([]*models.TagCount, 0, len(counts))
+	for name, count := range counts {
+		tags = append(tags, &models.TagCount{Name: name, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Name < tags[j].Name
+	})
+	return tags, nil
+}
+
+func (s *postStore) PublishDue(ctx context.Context, now int64) ([]*models.Post, error) {
+	isDue := func(p *models.Post) bool {
+		return p.Status == models.StatusScheduled && p.PublishAt <= now
+	}
+	// Looking for due posts first, so the data isn't persisted needlessly
+	found := false
+	s.read(func(d *data) error {
+		for _, p := range d.Posts {
+			if isDue(p) {
+				found = true
+				break
+			}
+		}
+		return nil
+	})
+	if !found {
+		return nil, nil
+	}
+	var published []*models.Post
+	err := s.write(func(d *data) error {
+		for _, p := range d.Posts {
+			if isDue(p) {
+				p.Status, p.PublishedAt = models.StatusPublished, now
+				d.touch("Posts", p.ID.Hex())
+				published = append(published, copyPost(p))
+			}
+		}
+		return nil
+	})
+	return published, err
+}
+
+func copyPost(p *models.Post) *models.Post {
+	post := *p
+	post.Tags = append([]string(nil), p.Tags...)
+	post.OldSlugs = append([]string(nil), p.OldSlugs...)
+	post.TOC = append([]markdown.Heading(nil), p.TOC...)
+	return &post
+}
+
+// slugTaken reports whether a post other than p has the slug or any old slug of p, like unique indexes of Mongo
+func slugTaken(d *data, p *models.Post) bool {
+	for _, other := range d.Posts {
+		if other.ID == p.ID {
+			continue
+		}
+		if p.Slug != "" && hasSlug(other, p.Slug) {
+			return true
+		}
+		for _, old := range p.OldSlugs {
+			if hasSlug(other, old) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasSlug(p *models.Post, slug string) bool {
+	if p.Slug == slug {
+		return true
+	}
+	for _, old := range p.OldSlugs {
+		if old == slug {
+			return true
+		}
+	}
+	return false
+}
+
+// sortPosts orders posts by publication time (newest first by default),
+// ties are broken by IDs which grow with time as well
+func sortPosts(posts []*models.PostWithAuthor, oldestFirst bool) {
+	sort.Slice(posts, func(i, j int) bool {
+		a, b := posts[i], posts[j]
+		if oldestFirst {
+			a, b = b, a
+		}
+		if a.PublicationTime() != b.PublicationTime() {
+			return a.PublicationTime() > b.PublicationTime()
+		}
+		return a.ID.Hex() > b.ID.Hex()
+	})
+}
+
+func paginate(posts []*models.PostWithAuthor, q models.PostsQuery) []*models.PostWithAuthor {
+	skip := q.Skip()
+	if skip < 0 {
+		skip = 0
+	}
+	if skip >= int64(len(posts)) {
+		return nil
+	}
+	end := int64(len(posts))
+	if q.PageSize > 0 && skip+q.PageSize < end {
+		end = skip + q.PageSize
+	}
+	return posts[skip:end]
+}
@@ -0,0 +1,58 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type passwordResetStore struct {
+	*Store
+}
+
+func (s *passwordResetStore) Create(ctx context.Context, reset *models.PasswordReset) error {
+	reset.CreationTime = time.Now().Unix()
+	reset.ID = primitive.NewObjectID()
+	return s.write(func(d *data) error {
+		copied := *reset
+		d.PasswordResets[reset.ID.Hex()] = &copied
+		d.touch("PasswordResets", reset.ID.Hex())
+		return nil
+	})
+}
+
+func (s *passwordResetStore) Use(ctx context.Context, tokenHash string, now int64) (*models.PasswordReset, error) {
+	var reset *models.PasswordReset
+	err := s.write(func(d *data) error {
+		for id, r := range d.PasswordResets {
+			if r.TokenHash == tokenHash {
+				delete(d.PasswordResets, id)
+				d.touch("PasswordResets", id)
+				reset = r
+				return nil
+			}
+		}
+		return models.ErrNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reset.ExpiresAt <= now {
+		return nil, models.ErrNotFound
+	}
+	return reset, nil
+}
+
+func (s *passwordResetStore) DeleteByUser(ctx context.Context, userID primitive.ObjectID) error {
+	return s.write(func(d *data) error {
+		for id, r := range d.PasswordResets {
+			if r.UserID == userID {
+				delete(d.PasswordResets, id)
+				d.touch("PasswordResets", id)
+			}
+		}
+		return nil
+	})
+}
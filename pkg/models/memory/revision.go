@@ -0,0 +1,73 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/meddion/web-blog/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type revisionStore struct {
+	*Store
+}
+
+func (s *revisionStore) Add(ctx context.Context, rev *models.Revision) error {
+	return s.write(func(d *data) error {
+		var last int64
+		for _, r := range d.Revisions {
+			if r.PostID == rev.PostID && r.Rev > last {
+				last = r.Rev
+			}
+		}
+		rev.Rev = last + 1
+		rev.ID = primitive.NewObjectID()
+		revision := *rev
+		d.Revisions[rev.ID.Hex()] = &revision
+		d.touch("Revisions", rev.ID.Hex())
+		return nil
+	})
+}
+
+func (s *revisionStore) List(ctx context.Context, postID primitive.ObjectID) ([]*models.Revision, error) {
+	revs := make([]*models.Revision, 0)
+	s.read(func(d *data) error {
+		for _, r := range d.Revisions {
+			if r.PostID == postID {
+				revision := *r
+				revision.Content = ""
+				revs = append(revs, &revision)
+			}
+		}
+		return nil
+	})
+	sort.Slice(revs, func(i, j int) bool { return revs[i].Rev > revs[j].Rev })
+	return revs, nil
+}
+
+func (s *revisionStore) Get(ctx context.Context, postID primitive.ObjectID, rev int64) (*models.Revision, error) {
+	var revision *models.Revision
+	err := s.read(func(d *data) error {
+		for _, r := range d.Revisions {
+			if r.PostID == postID && r.Rev == rev {
+				copied := *r
+				revision = &copied
+				return nil
+			}
+		}
+		return models.ErrNotFound
+	})
+	return revision, err
+}
+
+func (s *revisionStore) DeleteByPost(ctx context.Context, postID primitive.ObjectID) error {
+	return s.write(func(d *data) error {
+		for id, r := range d.Revisions {
+			if r.PostID == postID {
+				delete(d.Revisions, id)
+				d.touch("Revisions", id)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,124 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/meddion/web-blog/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type fileStore struct {
+	*Store
+}
+
+func fileKey(f *models.File) string {
+	return f.Dir + "\x00" + f.Name + "\x00" + f.Ext
+}
+
+// chunkSize is the size of chunks the contents of files are kept in, the same as GridFS uses
+const chunkSize = 255 * 1024
+
+// Save reads content in chunks before taking the lock, then replaces the file with the same dir, name & ext
+// keeping its ID, or inserts a new one
+func (s *fileStore) Save(ctx context.Context, f *models.File, content io.Reader) (created bool, err error) {
+	chunks, size, err := readChunks(content)
+	if err != nil {
+		return false, err
+	}
+	err = s.write(func(d *data) error {
+		file := *f
+		file.Size = size
+		file.ContentID = primitive.NewObjectID()
+		file.File = primitive.Binary{}
+		if old, ok := d.Files[fileKey(f)]; ok {
+			file.ID = old.ID
+			delete(d.FileChunks, old.ContentID.Hex())
+			d.touch("FileChunks", old.ContentID.Hex())
+		} else {
+			file.ID = primitive.NewObjectID()
+			created = true
+		}
+		d.Files[fileKey(f)] = &file
+		d.FileChunks[file.ContentID.Hex()] = chunks
+		d.touch("Files", fileKey(f))
+		d.touch("FileChunks", file.ContentID.Hex())
+		*f = file
+		return nil
+	})
+	return
+}
+
+// Open returns a reader of the chunks of the file, chunks are never changed once they are saved,
+// so they are read without the lock
+func (s *fileStore) Open(ctx context.Context, f *models.File) (io.ReadCloser, error) {
+	var chunks [][]byte
+	err := s.read(func(d *data) error {
+		file, ok := d.Files[fileKey(f)]
+		if !ok {
+			return models.ErrNotFound
+		}
+		*f = *file
+		chunks = d.FileChunks[file.ContentID.Hex()]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if content, ok := f.LegacyContent(); ok {
+		return content, nil
+	}
+	readers := make([]io.Reader, 0, len(chunks))
+	for _, chunk := range chunks {
+		readers = append(readers, bytes.NewReader(chunk))
+	}
+	return ioutil.NopCloser(io.MultiReader(readers...)), nil
+}
+
+func (s *fileStore) Delete(ctx context.Context, f *models.File) error {
+	return s.write(func(d *data) error {
+		old, ok := d.Files[fileKey(f)]
+		if !ok {
+			return models.ErrNotFound
+		}
+		delete(d.FileChunks, old.ContentID.Hex())
+		delete(d.Files, fileKey(f))
+		d.touch("Files", fileKey(f))
+		d.touch("FileChunks", old.ContentID.Hex())
+		return nil
+	})
+}
+
+// readChunks reads r to the end in chunks of chunkSize, so large files don't need contiguous memory
+func readChunks(r io.Reader) (chunks [][]byte, size int64, err error) {
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			chunks = append(chunks, append([]byte(nil), buf[:n]...))
+			size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return chunks, size, nil
+		} else if err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+func (s *fileStore) ListFilenames(ctx context.Context, dir, ext string) ([]string, error) {
+	filenames := make([]string, 0)
+	s.read(func(d *data) error {
+		for _, f := range d.Files {
+			if f.Dir == dir && (ext == "*" || f.Ext == ext) {
+				filenames = append(filenames, f.Name+"."+f.Ext)
+			}
+		}
+		return nil
+	})
+	sort.Strings(filenames)
+	return filenames, nil
+}
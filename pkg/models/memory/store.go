@@ -0,0 +1,162 @@
+// Package memory implements models' stores which keep all the data in process memory,
+// optionally persisting it to a single local file: each write appends the records it changes to the file,
+// which is rewritten once the appended changes outgrow the rest of it
+package memory
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/models"
+)
+
+// lazyInterval is how often changes made by lazy writes (e.g. the last use of API tokens) are persisted at most
+const lazyInterval = time.Minute
+
+// Store holds every collection of our application guarded by a single lock
+type Store struct {
+	mu   sync.RWMutex
+	data *data
+	path string   // the file data is persisted to, empty if it's not
+	file *os.File // the data file opened for appending
+	// The size of the data file & the size of it right after it was compacted last
+	size, compacted int64
+	// Set when persisting the changes of lazy writes is scheduled, along with the time data was persisted last
+	dirty     bool
+	persisted time.Time
+}
+
+type data struct {
+	Posts     map[string]*models.Post
+	Users     map[string]*models.User
+	Files     map[string]*models.File
+	Revisions map[string]*models.Revision
+	Comments  map[string]*models.Comment
+	Invites   map[string]*models.Invite
+
+	PasswordResets map[string]*models.PasswordReset
+	APITokens      map[string]*models.APIToken
+	Lockouts       map[string]*models.Lockout
+	FileChunks     map[string][][]byte // the contents of files by their ContentID (hex)
+
+	// The keys of records changed since data was persisted last by the names of their collections,
+	// nil if data isn't persisted
+	changed map[string]map[string]bool
+}
+
+func newData() *data {
+	d := &data{}
+	d.init()
+	return d
+}
+
+// init makes the collections which are missing (gob leaves empty maps nil)
+func (d *data) init() {
+	if d.Posts == nil {
+		d.Posts = make(map[string]*models.Post)
+	}
+	if d.Users == nil {
+		d.Users = make(map[string]*models.User)
+	}
+	if d.Files == nil {
+		d.Files = make(map[string]*models.File)
+	}
+	if d.FileChunks == nil {
+		d.FileChunks = make(map[string][][]byte)
+	}
+	if d.Revisions == nil {
+		d.Revisions = make(map[string]*models.Revision)
+	}
+	if d.Comments == nil {
+		d.Comments = make(map[string]*models.Comment)
+	}
+	if d.Invites == nil {
+		d.Invites = make(map[string]*models.Invite)
+	}
+	if d.PasswordResets == nil {
+		d.PasswordResets = make(map[string]*models.PasswordReset)
+	}
+	if d.APITokens == nil {
+		d.APITokens = make(map[string]*models.APIToken)
+	}
+	if d.Lockouts == nil {
+		d.Lockouts = make(map[string]*models.Lockout)
+	}
+}
+
+// New returns an empty Store
+func New() *Store {
+	return &Store{data: newData()}
+}
+
+// NewStores returns models' stores backed by a new empty Store
+func NewStores() *models.Stores {
+	return New().Stores()
+}
+
+// Stores returns models' stores backed by s
+func (s *Store) Stores() *models.Stores {
+	return &models.Stores{
+		Posts:     &postStore{s},
+		Users:     &userStore{s},
+		Files:     &fileStore{s},
+		Revisions: &revisionStore{s},
+		Comments:  &commentStore{s},
+		Invites:   &inviteStore{s},
+		Resets:    &passwordResetStore{s},
+		Tokens:    &apiTokenStore{s},
+		Lockouts:  &lockoutStore{s},
+	}
+}
+
+// read runs fn holding a read lock
+func (s *Store) read(fn func(d *data) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return fn(s.data)
+}
+
+// write runs fn holding a write lock & persists the data if fn succeeds
+func (s *Store) write(fn func(d *data) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := fn(s.data); err != nil {
+		return err
+	}
+	return s.persist()
+}
+
+// writeLazily runs fn holding a write lock, the data is persisted along with the next write
+// or once lazyInterval has passed since it was persisted last; it's meant for changes made on every request
+// which are fine to lose on crashes
+func (s *Store) writeLazily(fn func(d *data) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := fn(s.data); err != nil {
+		return err
+	}
+	if s.path == "" || s.dirty {
+		return nil
+	}
+	wait := lazyInterval - time.Since(s.persisted)
+	if wait <= 0 {
+		return s.persist()
+	}
+	s.dirty = true
+	time.AfterFunc(wait, s.flush)
+	return nil
+}
+
+// flush persists the changes made by lazy writes unless they were persisted already
+func (s *Store) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty {
+		return
+	}
+	if err := s.persist(); err != nil {
+		log.Printf("on persisting the data: %s", err.Error())
+	}
+}
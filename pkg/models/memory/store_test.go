@@ -0,0 +1,577 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func createMockedPosts(t *testing.T, posts models.PostStore, n int) []*models.Post {
+	created := make([]*models.Post, n)
+	for i := range created {
+		created[i] = &models.Post{Title: "title", Content: "content"}
+		if err := posts.Save(context.TODO(), created[i]); err != nil {
+			t.Fatalf("on saving a post: %s", err.Error())
+		}
+	}
+	return created
+}
+
+func TestListPosts(t *testing.T) {
+	posts := NewStores().Posts
+	created := createMockedPosts(t, posts, 25)
+
+	cases := []struct {
+		query    models.PostsQuery
+		expected []*models.Post
+	}{
+		{models.PostsQuery{PageSize: 10, PageNum: 1}, []*models.Post{created[24], created[15]}},
+		{models.PostsQuery{PageSize: 10, PageNum: 3}, []*models.Post{created[4], created[0]}},
+		{models.PostsQuery{PageSize: 10, PageNum: 1, OldestFirst: true}, []*models.Post{created[0], created[9]}},
+		{models.PostsQuery{PageSize: 10, PageNum: 3, OldestFirst: true}, []*models.Post{created[20], created[24]}},
+	}
+	for _, c := range cases {
+		got, err := posts.List(context.TODO(), c.query)
+		if err != nil {
+			t.Fatalf("on listing posts: %s", err.Error())
+		}
+		first, last := got[0], got[len(got)-1]
+		if first.ID != c.expected[0].ID || last.ID != c.expected[1].ID {
+			t.Fatalf("with query %v expected a page from %s to %s, instead we got: from %s to %s",
+				c.query, c.expected[0].ID.Hex(), c.expected[1].ID.Hex(), first.ID.Hex(), last.ID.Hex())
+		}
+	}
+
+	got, err := posts.List(context.TODO(), models.PostsQuery{PageSize: 10, PageNum: 4})
+	if err != nil || len(got) != 0 {
+		t.Fatalf("on listing a page out of range expected nothing, instead we got: %v (%v)", got, err)
+	}
+}
+
+func TestUpdatePost(t *testing.T) {
+	posts := NewStores().Posts
+	post := createMockedPosts(t, posts, 1)[0]
+
+	update := &models.Post{ID: post.ID, Title: "new title"}
+	if err := posts.Update(context.TODO(), update); err != nil {
+		t.Fatalf("on updating a post: %s", err.Error())
+	}
+	got, err := posts.GetByID(context.TODO(), post.ID.Hex())
+	if err != nil {
+		t.Fatalf("on getting a post: %s", err.Error())
+	}
+	if got.Title != "new title" || got.Content != "" || got.CreationTime != post.CreationTime {
+		t.Fatalf("on getting a wrongly updated post: %v", got)
+	}
+
+	if err := posts.DeleteByID(context.TODO(), post.ID.Hex()); err != nil {
+		t.Fatalf("on deleting a post: %s", err.Error())
+	}
+	if err := posts.Update(context.TODO(), update); err != models.ErrNotFound {
+		t.Fatalf("on updating a deleted post expected ErrNotFound, instead we got: %v", err)
+	}
+}
+
+func TestSaveFile(t *testing.T) {
+	files := NewStores().Files
+	for i, expected := range []bool{true, false} {
+		f := models.NewEmptyFile("/test", "name", "custom")
+		created, err := files.Save(context.TODO(), f, bytes.NewReader([]byte{byte(i)}))
+		if err != nil {
+			t.Fatalf("on saving a file: %s", err.Error())
+		}
+		if created != expected {
+			t.Fatalf("on saving the file #%d expected created to be %v", i, expected)
+		}
+	}
+	f := models.NewEmptyFile("/test", "name", "custom")
+	content := openFile(t, files, f)
+	if !reflect.DeepEqual(content, []byte{1}) || f.Size != 1 {
+		t.Fatalf("on getting the file which wasn't replaced: %v", content)
+	}
+
+	// Files larger than a chunk are split into chunks & read back whole
+	large := bytes.Repeat([]byte("0123456789"), chunkSize/4)
+	if _, err := files.Save(context.TODO(), f, bytes.NewReader(large)); err != nil {
+		t.Fatalf("on saving a file: %s", err.Error())
+	}
+	if content := openFile(t, files, f); !bytes.Equal(content, large) || f.Size != int64(len(large)) {
+		t.Fatalf("on getting a large file expected %d bytes, instead we got: %d", len(large), len(content))
+	}
+
+	// A failed upload keeps the previous contents
+	failing := iotest.TimeoutReader(bytes.NewReader([]byte{2, 3}))
+	if _, err := files.Save(context.TODO(), models.NewEmptyFile("/test", "name", "custom"), failing); err == nil {
+		t.Fatal("expected saving a file which can't be read to fail")
+	}
+	if content := openFile(t, files, f); !bytes.Equal(content, large) {
+		t.Fatal("expected a failed upload to keep the contents of the file")
+	}
+}
+
+func openFile(t *testing.T, files models.FileStore, f *models.File) []byte {
+	r, err := files.Open(context.TODO(), f)
+	if err != nil {
+		t.Fatalf("on opening a file: %s", err.Error())
+	}
+	defer r.Close()
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("on reading a file: %s", err.Error())
+	}
+	return content
+}
+
+func TestListFilenames(t *testing.T) {
+	files := NewStores().Files
+	for _, f := range []*models.File{
+		models.NewEmptyFile("/test", "b", "png"),
+		models.NewEmptyFile("/test", "a", "jpg"),
+		models.NewEmptyFile("/test", "c", "png"),
+		models.NewEmptyFile("/other", "d", "png"),
+	} {
+		if _, err := files.Save(context.TODO(), f, strings.NewReader("")); err != nil {
+			t.Fatalf("on saving a file: %s", err.Error())
+		}
+	}
+
+	cases := []struct {
+		dir, ext string
+		expected []string
+	}{
+		{"/test", "png", []string{"b.png", "c.png"}},
+		{"/test", "*", []string{"a.jpg", "b.png", "c.png"}},
+		{"/none", "*", []string{}},
+	}
+	for _, c := range cases {
+		got, err := files.ListFilenames(context.TODO(), c.dir, c.ext)
+		if err != nil {
+			t.Fatalf("on listing filenames: %s", err.Error())
+		}
+		if !reflect.DeepEqual(got, c.expected) {
+			t.Fatalf("with %s/*.%s expected %v, instead we got: %v", c.dir, c.ext, c.expected, got)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "blog.db")
+
+	stores, err := OpenStores(path)
+	if err != nil {
+		t.Fatalf("on opening a new data file: %s", err.Error())
+	}
+	post := createMockedPosts(t, stores.Posts, 1)[0]
+	if _, err := stores.Files.Save(context.TODO(), models.NewEmptyFile("/test", "name", "custom"), strings.NewReader("file contents")); err != nil {
+		t.Fatalf("on saving a file: %s", err.Error())
+	}
+
+	stores, err = OpenStores(path)
+	if err != nil {
+		t.Fatalf("on reopening the data file: %s", err.Error())
+	}
+	if got, err := stores.Posts.GetByID(context.TODO(), post.ID.Hex()); err != nil || !reflect.DeepEqual(got, post) {
+		t.Fatalf("on getting the persisted post %v, instead we got: %v (%v)", post, got, err)
+	}
+	if content := openFile(t, stores.Files, models.NewEmptyFile("/test", "name", "custom")); string(content) != "file contents" {
+		t.Fatalf("on getting the persisted file: %q", content)
+	}
+}
+
+func TestPersistIncrementally(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "blog.db")
+	size := func() int64 {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Size()
+	}
+
+	stores, err := OpenStores(path)
+	if err != nil {
+		t.Fatalf("on opening a new data file: %s", err.Error())
+	}
+	content := bytes.Repeat([]byte{1}, 100*1024)
+	if _, err := stores.Files.Save(context.TODO(), models.NewEmptyFile("/test", "name", "custom"), bytes.NewReader(content)); err != nil {
+		t.Fatalf("on saving a file: %s", err.Error())
+	}
+	before := size()
+	post := createMockedPosts(t, stores.Posts, 1)[0]
+	if appended := size() - before; appended <= 0 || appended >= int64(len(content)) {
+		t.Fatalf("expected only the new post to be appended to the data file, instead it grew by %d bytes", appended)
+	}
+	if err := stores.Posts.DeleteByID(context.TODO(), post.ID.Hex()); err != nil {
+		t.Fatalf("on deleting a post: %s", err.Error())
+	}
+
+	// An entry cut short by a crash is dropped
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 1, 0, 1, 2})
+	f.Close()
+	stores, err = OpenStores(path)
+	if err != nil {
+		t.Fatalf("on reopening the data file: %s", err.Error())
+	}
+	if _, err := stores.Posts.GetByID(context.TODO(), post.ID.Hex()); err != models.ErrNotFound {
+		t.Fatalf("expected the deleted post to stay deleted, instead we got: %v", err)
+	}
+	if got := openFile(t, stores.Files, models.NewEmptyFile("/test", "name", "custom")); !bytes.Equal(got, content) {
+		t.Fatalf("on getting the persisted file of %d bytes", len(got))
+	}
+	createMockedPosts(t, stores.Posts, 1)
+	if _, err := OpenStores(path); err != nil {
+		t.Fatalf("on reopening the data file after a torn entry: %s", err.Error())
+	}
+
+	// Replaced contents are dropped once the data file is compacted
+	content = bytes.Repeat([]byte{2}, 400*1024)
+	for i := 0; i < 4; i++ {
+		if _, err := stores.Files.Save(context.TODO(), models.NewEmptyFile("/test", "name", "custom"), bytes.NewReader(content)); err != nil {
+			t.Fatalf("on saving a file: %s", err.Error())
+		}
+	}
+	if got := size(); got > 3*int64(len(content)) {
+		t.Fatalf("expected the data file to be compacted, instead it takes %d bytes", got)
+	}
+	stores, err = OpenStores(path)
+	if err != nil {
+		t.Fatalf("on reopening the compacted data file: %s", err.Error())
+	}
+	if got := openFile(t, stores.Files, models.NewEmptyFile("/test", "name", "custom")); !bytes.Equal(got, content) {
+		t.Fatalf("on getting the file of %d bytes from the compacted data file", len(got))
+	}
+}
+
+func TestOpenLegacyDataFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "blog.db")
+
+	// Earlier versions encoded the whole data at once
+	legacy := newData()
+	post := &models.Post{ID: primitive.NewObjectID(), Title: "title"}
+	legacy.Posts[post.ID.Hex()] = post
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gob.NewEncoder(f).Encode(legacy); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	for i := 0; i < 2; i++ {
+		stores, err := OpenStores(path)
+		if err != nil {
+			t.Fatalf("on opening the data file: %s", err.Error())
+		}
+		if got, err := stores.Posts.GetByID(context.TODO(), post.ID.Hex()); err != nil || got.Title != "title" {
+			t.Fatalf("on getting the post of the legacy data file: %v (%v)", got, err)
+		}
+	}
+}
+
+func TestUseAPITokenLazily(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "blog.db")
+
+	stores, err := OpenStores(path)
+	if err != nil {
+		t.Fatalf("on opening a new data file: %s", err.Error())
+	}
+	apiToken, token, err := models.NewAPIToken(primitive.NewObjectID(), "ci", []string{models.ScopePostsWrite}, time.Hour)
+	if err != nil {
+		t.Fatalf("on making an API token: %s", err.Error())
+	}
+	if err := stores.Tokens.Create(context.TODO(), apiToken); err != nil {
+		t.Fatalf("on creating an API token: %s", err.Error())
+	}
+	lastUsed := func() int64 {
+		reopened, err := OpenStores(path)
+		if err != nil {
+			t.Fatalf("on reopening the data file: %s", err.Error())
+		}
+		tokens, err := reopened.Tokens.ListByUser(context.TODO(), apiToken.UserID)
+		if err != nil || len(tokens) != 1 {
+			t.Fatalf("on listing the API tokens: %v (%v)", tokens, err)
+		}
+		return tokens[0].LastUsed
+	}
+
+	now := time.Now().Unix()
+	if _, err := stores.Tokens.Use(context.TODO(), models.HashToken(token), now); err != nil {
+		t.Fatalf("on using the API token: %s", err.Error())
+	}
+	if got := lastUsed(); got != 0 {
+		t.Fatalf("expected the use of the token not to be persisted right away, instead we got: %d", got)
+	}
+	createMockedPosts(t, stores.Posts, 1)
+	if got := lastUsed(); got != now {
+		t.Fatalf("expected the use of the token to be persisted along with the next write, instead we got: %d", got)
+	}
+}
+
+func TestTags(t *testing.T) {
+	posts := NewStores().Posts
+	for _, tags := range [][]string{{"go", "web"}, {"go"}, {"db"}} {
+		if err := posts.Save(context.TODO(), &models.Post{Tags: tags}); err != nil {
+			t.Fatalf("on saving a post: %s", err.Error())
+		}
+	}
+	got, err := posts.Tags(context.TODO(), models.PostFilter{})
+	if err != nil {
+		t.Fatalf("on getting tags: %s", err.Error())
+	}
+	expected := []*models.TagCount{{Name: "go", Count: 2}, {Name: "db", Count: 1}, {Name: "web", Count: 1}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected tags %v, instead we got: %v", expected, got)
+	}
+
+	filter := models.PostFilter{Tag: "go"}
+	if n, err := posts.Count(context.TODO(), filter); err != nil || n != 2 {
+		t.Fatalf("on counting posts tagged \"go\" expected 2, instead we got: %d (%v)", n, err)
+	}
+	list, err := posts.List(context.TODO(), models.PostsQuery{Filter: filter, PageSize: 10, PageNum: 1})
+	if err != nil || len(list) != 2 {
+		t.Fatalf("on listing posts tagged \"go\" expected 2, instead we got: %d (%v)", len(list), err)
+	}
+}
+
+func TestVisibility(t *testing.T) {
+	posts := NewStores().Posts
+	author, now := primitive.NewObjectID(), time.Now().Unix()
+	for _, p := range []*models.Post{
+		{Status: models.StatusPublished, PublishedAt: now - 10},
+		{Status: models.StatusDraft, AuthorID: author},
+		{Status: models.StatusScheduled, PublishAt: now - 5},
+		{Status: models.StatusScheduled, PublishAt: now + 3600},
+	} {
+		if err := posts.Save(context.TODO(), p); err != nil {
+			t.Fatalf("on saving a post: %s", err.Error())
+		}
+	}
+
+	count := func(filter models.PostFilter) int64 {
+		n, err := posts.Count(context.TODO(), filter)
+		if err != nil {
+			t.Fatalf("on counting posts: %s", err.Error())
+		}
+		return n
+	}
+	if n := count(models.PostFilter{VisibleAt: now}); n != 1 {
+		t.Fatalf("expected anonymous readers to see 1 post, instead they see: %d", n)
+	}
+	if n := count(models.PostFilter{VisibleAt: now, ViewerID: author}); n != 2 {
+		t.Fatalf("expected the author to see 2 posts, instead they see: %d", n)
+	}
+
+	published, err := posts.PublishDue(context.TODO(), now)
+	if err != nil {
+		t.Fatalf("on publishing due posts: %s", err.Error())
+	}
+	if len(published) != 1 || published[0].PublishedAt != now {
+		t.Fatalf("expected 1 post to be published at %d, instead we got: %v", now, published)
+	}
+	if n := count(models.PostFilter{VisibleAt: now}); n != 2 {
+		t.Fatalf("expected anonymous readers to see 2 posts, instead they see: %d", n)
+	}
+}
+
+func TestSlugs(t *testing.T) {
+	posts := NewStores().Posts
+	save := func(title string) *models.Post {
+		p := &models.Post{Title: title}
+		if err := p.ValidateSlug(context.TODO(), posts, nil); err != nil {
+			t.Fatalf("on validating a slug: %s", err.Error())
+		}
+		if err := posts.Save(context.TODO(), p); err != nil {
+			t.Fatalf("on saving a post: %s", err.Error())
+		}
+		return p
+	}
+	first, second := save("Hello World"), save("Hello, world!")
+	if first.Slug != "hello-world" || second.Slug != "hello-world-2" {
+		t.Fatalf("expected slugs hello-world & hello-world-2, instead we got: %s & %s", first.Slug, second.Slug)
+	}
+
+	update := &models.Post{ID: first.ID, Title: first.Title, Slug: "Greetings"}
+	if err := update.ValidateSlug(context.TODO(), posts, first); err != nil {
+		t.Fatalf("on validating an edited slug: %s", err.Error())
+	}
+	if err := posts.Update(context.TODO(), update); err != nil {
+		t.Fatalf("on updating a post: %s", err.Error())
+	}
+	for _, slug := range []string{"greetings", "hello-world"} {
+		got, err := posts.GetBySlug(context.TODO(), slug)
+		if err != nil || got.ID != first.ID || got.Slug != "greetings" {
+			t.Fatalf("on getting the post by the slug %s: %v (%v)", slug, got, err)
+		}
+	}
+
+	// The old slug of the first post is still taken
+	update = &models.Post{ID: second.ID, Title: second.Title, Slug: "hello-world"}
+	if err := update.ValidateSlug(context.TODO(), posts, second); err == nil {
+		t.Fatal("expected an error on taking an old slug of another post")
+	}
+}
+
+func TestDeleteCommentThread(t *testing.T) {
+	comments := NewStores().Comments
+	postID := primitive.NewObjectID()
+	root := &models.Comment{PostID: postID, Content: "root", Status: models.CommentApproved}
+	other := &models.Comment{PostID: postID, Content: "other", Status: models.CommentApproved}
+	for _, c := range []*models.Comment{root, other} {
+		if err := comments.Create(context.TODO(), c); err != nil {
+			t.Fatalf("on creating a comment: %s", err.Error())
+		}
+	}
+	parentID := root.ID
+	for i := 0; i < 3; i++ {
+		reply := &models.Comment{PostID: postID, ParentID: parentID, Content: "reply", Status: models.CommentPending}
+		if err := comments.Create(context.TODO(), reply); err != nil {
+			t.Fatalf("on creating a reply: %s", err.Error())
+		}
+		parentID = reply.ID
+	}
+
+	if n, _ := comments.Count(context.TODO(), models.CommentFilter{PostID: postID, Status: models.CommentApproved}); n != 2 {
+		t.Fatalf("expected 2 approved comments, instead we got: %d", n)
+	}
+	if err := comments.DeleteByID(context.TODO(), root.ID); err != nil {
+		t.Fatalf("on deleting a comment: %s", err.Error())
+	}
+	left, err := comments.List(context.TODO(), models.CommentsQuery{Filter: models.CommentFilter{PostID: postID}, PageSize: 10, PageNum: 1})
+	if err != nil {
+		t.Fatalf("on listing comments: %s", err.Error())
+	}
+	if len(left) != 1 || left[0].ID != other.ID {
+		t.Fatalf("expected only the unrelated comment to be left, instead we got: %v", left)
+	}
+}
+
+func TestUseInvite(t *testing.T) {
+	invites := NewStores().Invites
+	invite, token, err := models.NewInvite(models.RoleAuthor, 2, time.Hour)
+	if err != nil {
+		t.Fatalf("on making an invite: %s", err.Error())
+	}
+	if err := invites.Create(context.TODO(), invite); err != nil {
+		t.Fatalf("on creating an invite: %s", err.Error())
+	}
+	now := time.Now().Unix()
+	cases := []struct {
+		token string
+		now   int64
+		err   error
+	}{
+		{"wrong", now, models.ErrNotFound},
+		{token, invite.ExpiresAt, models.ErrNotFound},
+		{token, now, nil},
+		{token, now, nil},
+		{token, now, models.ErrNotFound},
+	}
+	for i, c := range cases {
+		if _, err := invites.Use(context.TODO(), models.HashToken(c.token), c.now); err != c.err {
+			t.Fatalf("on using the invite (case %d) expected error %v, instead we got: %v", i, c.err, err)
+		}
+	}
+}
+
+func TestUseAPIToken(t *testing.T) {
+	tokens := NewStores().Tokens
+	userID := primitive.NewObjectID()
+	apiToken, token, err := models.NewAPIToken(userID, "ci", []string{models.ScopePostsWrite}, time.Hour)
+	if err != nil {
+		t.Fatalf("on making an API token: %s", err.Error())
+	}
+	if err := tokens.Create(context.TODO(), apiToken); err != nil {
+		t.Fatalf("on creating an API token: %s", err.Error())
+	}
+	now := time.Now().Unix()
+	if _, err := tokens.Use(context.TODO(), models.HashToken(token), apiToken.ExpiresAt); err != models.ErrNotFound {
+		t.Fatalf("expected an expired token to be rejected, instead we got: %v", err)
+	}
+	used, err := tokens.Use(context.TODO(), models.HashToken(token), now)
+	if err != nil {
+		t.Fatalf("on using the API token: %s", err.Error())
+	}
+	if used.LastUsed != now || !used.Allows(models.PermWritePosts) || used.Allows(models.PermUploadFiles) {
+		t.Fatalf("got an unexpected API token: %v", used)
+	}
+	if err := tokens.Delete(context.TODO(), primitive.NewObjectID(), apiToken.ID); err != models.ErrNotFound {
+		t.Fatalf("expected a token of another user not to be deleted, instead we got: %v", err)
+	}
+	if err := tokens.Delete(context.TODO(), userID, apiToken.ID); err != nil {
+		t.Fatalf("on deleting the API token: %s", err.Error())
+	}
+	if _, err := tokens.Use(context.TODO(), models.HashToken(token), now); err != models.ErrNotFound {
+		t.Fatalf("expected a revoked token to be rejected, instead we got: %v", err)
+	}
+}
+
+func TestUseTOTP(t *testing.T) {
+	users := NewStores().Users
+	user := &models.User{Name: "alice", Email: "alice@example.com", Password: "hash"}
+	if err := users.Create(context.TODO(), user); err != nil {
+		t.Fatalf("on creating a user: %s", err.Error())
+	}
+	prev := &models.TOTP{Secret: "secret", Enabled: true, LastStep: 1, RecoveryCodes: []string{"a", "b"}}
+	if err := users.SetTOTP(context.TODO(), user.ID, prev); err != nil {
+		t.Fatalf("on setting the second factor: %s", err.Error())
+	}
+
+	// Two requests verifying the same code against the same stored second factor
+	byCode := *prev
+	byCode.LastStep = 2
+	if err := users.UseTOTP(context.TODO(), user.ID, prev, &byCode); err != nil {
+		t.Fatalf("on using a code: %s", err.Error())
+	}
+	if err := users.UseTOTP(context.TODO(), user.ID, prev, &byCode); err != models.ErrCodeUsed {
+		t.Fatalf("expected a replayed code to be rejected, instead we got: %v", err)
+	}
+
+	byRecovery := byCode
+	byRecovery.RecoveryCodes = []string{"b"}
+	if err := users.UseTOTP(context.TODO(), user.ID, &byCode, &byRecovery); err != nil {
+		t.Fatalf("on using a recovery code: %s", err.Error())
+	}
+	if err := users.UseTOTP(context.TODO(), user.ID, &byCode, &byRecovery); err != models.ErrCodeUsed {
+		t.Fatalf("expected a replayed recovery code to be rejected, instead we got: %v", err)
+	}
+	got, err := users.GetByID(context.TODO(), user.ID)
+	if err != nil || got.TOTP.LastStep != 2 || len(got.TOTP.RecoveryCodes) != 1 {
+		t.Fatalf("got an unexpected second factor: %v (%v)", got.TOTP, err)
+	}
+}
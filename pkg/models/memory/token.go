@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type apiTokenStore struct {
+	*Store
+}
+
+func (s *apiTokenStore) Create(ctx context.Context, t *models.APIToken) error {
+	t.CreationTime = time.Now().Unix()
+	t.ID = primitive.NewObjectID()
+	return s.write(func(d *data) error {
+		d.APITokens[t.ID.Hex()] = copyAPIToken(t)
+		d.touch("APITokens", t.ID.Hex())
+		return nil
+	})
+}
+
+func (s *apiTokenStore) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]*models.APIToken, error) {
+	tokens := make([]*models.APIToken, 0)
+	s.read(func(d *data) error {
+		for _, t := range d.APITokens {
+			if t.UserID == userID {
+				tokens = append(tokens, copyAPIToken(t))
+			}
+		}
+		return nil
+	})
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID.Hex() > tokens[j].ID.Hex() })
+	return tokens, nil
+}
+
+func (s *apiTokenStore) Delete(ctx context.Context, userID, id primitive.ObjectID) error {
+	return s.write(func(d *data) error {
+		if t, ok := d.APITokens[id.Hex()]; !ok || t.UserID != userID {
+			return models.ErrNotFound
+		}
+		delete(d.APITokens, id.Hex())
+		d.touch("APITokens", id.Hex())
+		return nil
+	})
+}
+
+func (s *apiTokenStore) DeleteByUser(ctx context.Context, userID primitive.ObjectID) error {
+	return s.write(func(d *data) error {
+		for id, t := range d.APITokens {
+			if t.UserID == userID {
+				delete(d.APITokens, id)
+				d.touch("APITokens", id)
+			}
+		}
+		return nil
+	})
+}
+
+// Use persists the last use of the token lazily, since it's done on every request authorized by a token
+func (s *apiTokenStore) Use(ctx context.Context, tokenHash string, now int64) (*models.APIToken, error) {
+	var token *models.APIToken
+	err := s.writeLazily(func(d *data) error {
+		for _, t := range d.APITokens {
+			if t.TokenHash == tokenHash && !t.IsExpired(now) {
+				t.LastUsed = now
+				d.touch("APITokens", t.ID.Hex())
+				token = copyAPIToken(t)
+				return nil
+			}
+		}
+		return models.ErrNotFound
+	})
+	return token, err
+}
+
+func copyAPIToken(t *models.APIToken) *models.APIToken {
+	copied := *t
+	copied.Scopes = append([]string(nil), t.Scopes...)
+	return &copied
+}
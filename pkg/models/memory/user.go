@@ -0,0 +1,147 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type userStore struct {
+	*Store
+}
+
+func (s *userStore) Create(ctx context.Context, u *models.User) error {
+	u.CreationTime = time.Now().Unix()
+	u.ID = primitive.NewObjectID()
+	return s.write(func(d *data) error {
+		user := *u
+		d.Users[u.ID.Hex()] = &user
+		d.touch("Users", u.ID.Hex())
+		return nil
+	})
+}
+
+// Update mirrors $set of the Mongo store: only non-empty fields are changed
+func (s *userStore) Update(ctx context.Context, u *models.User) error {
+	u.CreationTime = 0
+	return s.write(func(d *data) error {
+		user, ok := d.Users[u.ID.Hex()]
+		if !ok {
+			return nil
+		}
+		user.Assign(u)
+		d.touch("Users", u.ID.Hex())
+		return nil
+	})
+}
+
+func (s *userStore) DeleteByID(ctx context.Context, id primitive.ObjectID) error {
+	return s.write(func(d *data) error {
+		delete(d.Users, id.Hex())
+		d.touch("Users", id.Hex())
+		return nil
+	})
+}
+
+func (s *userStore) Count(ctx context.Context) (int64, error) {
+	var n int64
+	s.read(func(d *data) error {
+		n = int64(len(d.Users))
+		return nil
+	})
+	return n, nil
+}
+
+func (s *userStore) CountByRole(ctx context.Context, role string) (int64, error) {
+	var n int64
+	s.read(func(d *data) error {
+		for _, u := range d.Users {
+			if u.Role == role {
+				n++
+			}
+		}
+		return nil
+	})
+	return n, nil
+}
+
+func (s *userStore) SetTOTP(ctx context.Context, id primitive.ObjectID, t *models.TOTP) error {
+	return s.write(func(d *data) error {
+		user, ok := d.Users[id.Hex()]
+		if !ok {
+			return models.ErrNotFound
+		}
+		d.touch("Users", id.Hex())
+		user.TOTP = nil
+		if t != nil {
+			copied := *t
+			copied.RecoveryCodes = append([]string(nil), t.RecoveryCodes...)
+			user.TOTP = &copied
+		}
+		return nil
+	})
+}
+
+func (s *userStore) UseTOTP(ctx context.Context, id primitive.ObjectID, prev, next *models.TOTP) error {
+	return s.write(func(d *data) error {
+		user, ok := d.Users[id.Hex()]
+		if !ok || !sameTOTP(user.TOTP, prev) {
+			return models.ErrCodeUsed
+		}
+		d.touch("Users", id.Hex())
+		copied := *next
+		copied.RecoveryCodes = append([]string(nil), next.RecoveryCodes...)
+		user.TOTP = &copied
+		return nil
+	})
+}
+
+// sameTOTP reports whether no code of the second factor was used between a & b
+func sameTOTP(a, b *models.TOTP) bool {
+	if a == nil || b == nil || a.Enabled != b.Enabled || a.LastStep != b.LastStep || len(a.RecoveryCodes) != len(b.RecoveryCodes) {
+		return false
+	}
+	for i := range a.RecoveryCodes {
+		if a.RecoveryCodes[i] != b.RecoveryCodes[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *userStore) GetByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	return s.find(func(u *models.User) bool { return u.ID == id })
+}
+
+func (s *userStore) GetByName(ctx context.Context, name string) (*models.User, error) {
+	return s.find(func(u *models.User) bool { return u.Name == name })
+}
+
+func (s *userStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return s.find(func(u *models.User) bool { return u.Email == email })
+}
+
+// find returns a copy of the first user matching fn
+func (s *userStore) find(fn func(u *models.User) bool) (*models.User, error) {
+	user := &models.User{}
+	err := s.read(func(d *data) error {
+		for _, u := range d.Users {
+			if fn(u) {
+				*user = *u
+				if u.TOTP != nil {
+					t := *u.TOTP
+					t.RecoveryCodes = append([]string(nil), u.TOTP.RecoveryCodes...)
+					user.TOTP = &t
+				}
+				return nil
+			}
+		}
+		return models.ErrNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -3,11 +3,16 @@ package models
 import (
 	"context"
 	"errors"
-	"net/http"
+	"fmt"
+	"log"
+	"strings"
 	"time"
+	"unicode"
 
+	"github.com/meddion/web-blog/pkg/markdown"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 const collNamePost = "posts"
@@ -16,27 +21,212 @@ const collNamePost = "posts"
 type Post struct {
 	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	Title        string             `json:"title" bson:"title"`
+	Slug         string             `json:"slug" bson:"slug,omitempty"`
+	OldSlugs     []string           `json:"-" bson:"old_slugs,omitempty"`
 	Content      string             `json:"content" bson:"content"`
+	ContentHTML  string             `json:"content_html" bson:"content_html"`
+	TOC          []markdown.Heading `json:"toc" bson:"toc"`
+	Tags         []string           `json:"tags" bson:"tags"`
+	Status       string             `json:"status" bson:"status,omitempty"`
+	PublishAt    int64              `json:"publish_at" bson:"publish_at,omitempty"`
+	PublishedAt  int64              `json:"published_at" bson:"published_at,omitempty"`
 	AuthorID     primitive.ObjectID `json:"author_id" bson:"author_id,omitempty"`
+	EditorID     primitive.ObjectID `json:"editor_id" bson:"editor_id,omitempty"`
 	CreationTime int64              `json:"creation_time" bson:"creation_time,omitempty"`
 	LastEdited   int64              `json:"last_edited" bson:"last_edited,omitempty"`
 }
 
+// Post statuses, posts saved before statuses were introduced have none & count as published
+const (
+	StatusDraft     = "draft"
+	StatusPublished = "published"
+	StatusScheduled = "scheduled" // published by PublishScheduled once PublishAt comes
+)
+
+// PostWithAuthor is a post along with the public info (ID & name) of its author
 type PostWithAuthor struct {
 	Post   `bson:"inline"`
 	Author User `json:"author" bson:"author,omitempty"`
 }
 
-func (p *Post) Update(ctx context.Context) (err error) {
-	p.LastEdited = time.Now().Unix()
-	_, err = GetDB().Collection(collNamePost).UpdateOne(ctx, bson.M{"_id": p.ID}, bson.M{"$set": p})
+// TagCount is a tag along with the number of posts having it
+type TagCount struct {
+	Name  string `json:"name" bson:"_id"`
+	Count int64  `json:"count" bson:"count"`
+}
+
+const (
+	maxTagsPerPost = 10
+	maxTagLen      = 32
+)
+
+// ValidateTags normalizes tags of the post (lowercase, spaces replaced by dashes, no duplicates)
+// & checks that they consist only of letters, digits & dashes
+func (p *Post) ValidateTags() error {
+	tags := make([]string, 0, len(p.Tags))
+	seen := make(map[string]struct{}, len(p.Tags))
+	for _, tag := range p.Tags {
+		tag = normalizeTag(tag)
+		if tag == "" {
+			continue
+		}
+		if len(tag) > maxTagLen {
+			return fmt.Errorf("on receiving a tag that is more than %d chars long", maxTagLen)
+		}
+		for _, r := range tag {
+			if r != '-' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				return fmt.Errorf("on receiving a tag %q with chars other than letters, digits or dashes", tag)
+			}
+		}
+		if _, ok := seen[tag]; ok {
+			continue
+		}
+		seen[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+	if len(tags) > maxTagsPerPost {
+		return fmt.Errorf("on receiving more than %d tags", maxTagsPerPost)
+	}
+	p.Tags = tags
+	return nil
+}
+
+// RenderContent renders Markdown content of the post into sanitized HTML & its table of contents
+func (p *Post) RenderContent() (err error) {
+	p.ContentHTML, p.TOC, err = markdown.Render(p.Content)
 	return
 }
 
-func (p *Post) Save(ctx context.Context) error {
+// ValidateStatus checks the status of the post & sets its publication time,
+// prev is the post being updated or nil for a new one;
+// an empty status keeps the one of prev, new posts are published then
+func (p *Post) ValidateStatus(prev *Post) error {
+	if p.Status == "" && prev != nil {
+		p.Status, p.PublishAt = prev.Status, prev.PublishAt
+	}
+	if p.Status == "" {
+		p.Status = StatusPublished
+	}
+	switch p.Status {
+	case StatusPublished:
+		if prev != nil && prev.IsPublished() {
+			p.PublishedAt = prev.PublicationTime()
+		} else {
+			p.PublishedAt = time.Now().Unix()
+		}
+	case StatusScheduled:
+		if p.PublishAt == 0 {
+			return errors.New("on receiving a scheduled post without publish_at")
+		}
+		p.PublishedAt = 0
+	case StatusDraft:
+		p.PublishedAt = 0
+	default:
+		return fmt.Errorf("on receiving an unknown post status: %q", p.Status)
+	}
+	return nil
+}
+
+// IsPublished reports whether the post has been published
+func (p *Post) IsPublished() bool {
+	return p.Status == StatusPublished || p.Status == ""
+}
+
+// IsVisible reports whether the post can be seen at the given time (unix)
+// by the user with viewerID (zero for anonymous readers)
+func (p *Post) IsVisible(at int64, viewerID primitive.ObjectID) bool {
+	if !viewerID.IsZero() && p.AuthorID == viewerID {
+		return true
+	}
+	return p.IsPublished() && p.PublishedAt <= at
+}
+
+// HasTag reports whether the post is tagged with tag
+func (p *Post) HasTag(tag string) bool {
+	for _, t := range p.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// PublicationTime returns the time the post was published at,
+// falling back to the creation time for older or unpublished posts
+func (p *Post) PublicationTime() int64 {
+	if p.PublishedAt != 0 {
+		return p.PublishedAt
+	}
+	return p.CreationTime
+}
+
+// PublishScheduled publishes scheduled posts whose time has come, checking them every interval until ctx is done
+func PublishScheduled(ctx context.Context, posts PostStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		published, err := posts.PublishDue(ctx, time.Now().Unix())
+		if err != nil {
+			log.Printf("on publishing scheduled posts: %s", err.Error())
+		}
+		for _, p := range published {
+			log.Printf("the scheduled post %s was published", p.ID.Hex())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.Join(strings.Fields(tag), "-"))
+}
+
+// bson returns a Mongo filter matching the same posts as f
+func (f PostFilter) bson() bson.M {
+	filter := bson.M{}
+	if f.Tag != "" {
+		filter["tags"] = f.Tag
+	}
+	if f.VisibleAt != 0 {
+		visible := bson.A{bson.M{
+			"status":       bson.M{"$in": bson.A{StatusPublished, nil}},
+			"published_at": bson.M{"$not": bson.M{"$gt": f.VisibleAt}},
+		}}
+		if !f.ViewerID.IsZero() {
+			visible = append(visible, bson.M{"author_id": f.ViewerID})
+		}
+		filter["$or"] = visible
+	}
+	return filter
+}
+
+type mongoPostStore struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoPostStore) Update(ctx context.Context, p *Post) error {
+	p.LastEdited = time.Now().Unix()
+	res, err := s.coll.UpdateOne(ctx, bson.M{"_id": p.ID}, bson.M{"$set": p})
+	if isDuplicateKey(err) {
+		return ErrSlugTaken
+	} else if err != nil {
+		return err
+	}
+	if res.MatchedCount < 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoPostStore) Save(ctx context.Context, p *Post) error {
 	p.CreationTime = time.Now().Unix()
-	result, err := GetDB().Collection(collNamePost).InsertOne(ctx, p)
-	if err != nil {
+	result, err := s.coll.InsertOne(ctx, p)
+	if isDuplicateKey(err) {
+		return ErrSlugTaken
+	} else if err != nil {
 		return err
 	}
 	if objectID, ok := result.InsertedID.(primitive.ObjectID); ok {
@@ -46,58 +236,81 @@ func (p *Post) Save(ctx context.Context) error {
 	return errors.New("on retrieving undefined id type")
 }
 
-func DeletePostById(ctx context.Context, id string) error {
+func (s *mongoPostStore) DeleteByID(ctx context.Context, id string) error {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return err
 	}
-	res, err := GetDB().Collection(collNamePost).DeleteOne(ctx, bson.M{"_id": objectID})
+	res, err := s.coll.DeleteOne(ctx, bson.M{"_id": objectID})
 	if err != nil {
 		return err
 	}
 	if res.DeletedCount < 1 {
-		return errors.New("the resource was not found, thus nothing was deleted")
+		return ErrNotFound
 	}
 	return nil
 }
 
-func GetPostByID(ctx context.Context, id string) (*Post, error) {
+func (s *mongoPostStore) GetByID(ctx context.Context, id string) (*Post, error) {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return nil, err
 	}
 	post := &Post{}
-	err = GetDB().Collection(collNamePost).FindOne(ctx, bson.M{"_id": objectID}).Decode(post)
-	return post, err
+	if err = s.coll.FindOne(ctx, bson.M{"_id": objectID}).Decode(post); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return post, nil
 }
 
-func GetTotalNumOfPosts(ctx context.Context, filter interface{}) (int64, error) {
-	if filter == nil {
-		filter = bson.D{{}}
-	}
-	totalNumOfPosts, err := GetDB().Collection(collNamePost).CountDocuments(ctx, filter)
-	if err != nil {
-		return 0, err
+func (s *mongoPostStore) GetBySlug(ctx context.Context, slug string) (*Post, error) {
+	post := &Post{}
+	filter := bson.M{"$or": bson.A{bson.M{"slug": slug}, bson.M{"old_slugs": slug}}}
+	if err := s.coll.FindOne(ctx, filter).Decode(post); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
 	}
-	return totalNumOfPosts, nil
+	return post, nil
 }
 
-func CreatePostsPipeline(r *http.Request, pageSize, pageNum int64) interface{} {
-	sort := -1 // asc
-	if r.URL.Query().Get("sortByDate") == "desc" {
-		sort = 1 // desc
-	}
-	return bson.A{
-		bson.M{"$sort": bson.M{"creation_time": sort}},
-		bson.M{"$skip": (pageNum - 1) * pageSize},
-		bson.M{"$limit": pageSize},
+func (s *mongoPostStore) SlugTaken(ctx context.Context, slug string, exceptID primitive.ObjectID) (bool, error) {
+	filter := bson.M{
+		"_id": bson.M{"$ne": exceptID},
+		"$or": bson.A{bson.M{"slug": slug}, bson.M{"old_slugs": slug}},
 	}
+	n, err := s.coll.CountDocuments(ctx, filter)
+	return n > 0, err
+}
+
+func (s *mongoPostStore) Count(ctx context.Context, filter PostFilter) (int64, error) {
+	return s.coll.CountDocuments(ctx, filter.bson())
 }
 
-func GetPosts(ctx context.Context, pipeline interface{}) ([]*PostWithAuthor, error) {
+func (s *mongoPostStore) List(ctx context.Context, q PostsQuery) ([]*PostWithAuthor, error) {
 	var posts []*PostWithAuthor
 
-	cur, err := GetDB().Collection(collNamePost).Aggregate(ctx, pipeline)
+	sort := -1 // newest first
+	if q.OldestFirst {
+		sort = 1
+	}
+	pipeline := bson.A{
+		bson.M{"$match": q.Filter.bson()},
+		bson.M{"$addFields": bson.M{"sort_time": bson.M{"$ifNull": bson.A{"$published_at", "$creation_time"}}}},
+		bson.M{"$sort": bson.D{{Key: "sort_time", Value: sort}, {Key: "_id", Value: sort}}},
+		bson.M{"$skip": q.Skip()},
+		bson.M{"$limit": q.PageSize},
+		bson.M{"$project": bson.M{"sort_time": 0}},
+		// Joining only the public info of authors
+		bson.M{"$lookup": bson.M{"from": collNameUser, "localField": "author_id", "foreignField": "_id", "as": "author"}},
+		bson.M{"$unwind": bson.M{"path": "$author", "preserveNullAndEmptyArrays": true}},
+		bson.M{"$addFields": bson.M{"author": bson.M{"_id": "$author._id", "name": "$author.name"}}},
+	}
+	cur, err := s.coll.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
@@ -116,3 +329,50 @@ func GetPosts(ctx context.Context, pipeline interface{}) ([]*PostWithAuthor, err
 	}
 	return posts, nil
 }
+
+func (s *mongoPostStore) Tags(ctx context.Context, filter PostFilter) ([]*TagCount, error) {
+	pipeline := bson.A{
+		bson.M{"$match": filter.bson()},
+		bson.M{"$unwind": "$tags"},
+		bson.M{"$group": bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}}},
+		bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+	}
+	cur, err := s.coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	tags := make([]*TagCount, 0)
+	if err := cur.All(ctx, &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func (s *mongoPostStore) PublishDue(ctx context.Context, now int64) ([]*Post, error) {
+	filter := bson.M{"status": StatusScheduled, "publish_at": bson.M{"$lte": now}}
+	cur, err := s.coll.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var due []*Post
+	if err := cur.All(ctx, &due); err != nil {
+		return nil, err
+	}
+	var published []*Post
+	for _, p := range due {
+		// Matching the status again in case the post was changed in the meantime
+		res, err := s.coll.UpdateOne(ctx,
+			bson.M{"_id": p.ID, "status": StatusScheduled},
+			bson.M{"$set": bson.M{"status": StatusPublished, "published_at": now}},
+		)
+		if err != nil {
+			return published, err
+		}
+		if res.ModifiedCount > 0 {
+			p.Status, p.PublishedAt = StatusPublished, now
+			published = append(published, p)
+		}
+	}
+	return published, nil
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateTags(t *testing.T) {
+	cases := []struct {
+		in       []string
+		expected []string
+		isErr    bool
+	}{
+		{[]string{"Go", " web  dev ", "go", ""}, []string{"go", "web-dev"}, false},
+		{[]string{"c++"}, nil, true},
+		{[]string{strings.Repeat("a", maxTagLen+1)}, nil, true},
+		{strings.Split("a b c d e f g h i j k", " "), nil, true},
+		{nil, []string{}, false},
+	}
+	for _, c := range cases {
+		p := &Post{Tags: c.in}
+		err := p.ValidateTags()
+		if (err != nil) != c.isErr {
+			t.Fatalf("with tags %q expected an error: %v, instead we got: %v", c.in, c.isErr, err)
+		}
+		if !c.isErr && !reflect.DeepEqual(p.Tags, c.expected) {
+			t.Fatalf("with tags %q expected %q, instead we got: %q", c.in, c.expected, p.Tags)
+		}
+	}
+}
+
+func TestValidateStatus(t *testing.T) {
+	draft := &Post{Status: StatusDraft}
+	p := &Post{}
+	if err := p.ValidateStatus(draft); err != nil {
+		t.Fatalf("on updating a draft without a status: %s", err.Error())
+	}
+	if p.Status != StatusDraft || p.PublishedAt != 0 {
+		t.Fatalf("expected an update without a status to keep the draft, instead we got: %q (%d)", p.Status, p.PublishedAt)
+	}
+
+	scheduled := &Post{Status: StatusScheduled, PublishAt: 42}
+	p = &Post{}
+	if err := p.ValidateStatus(scheduled); err != nil || p.Status != StatusScheduled || p.PublishAt != 42 {
+		t.Fatalf("expected an update without a status to keep the schedule, instead we got: %q at %d (%v)", p.Status, p.PublishAt, err)
+	}
+
+	p = &Post{}
+	if err := p.ValidateStatus(nil); err != nil || p.Status != StatusPublished || p.PublishedAt == 0 {
+		t.Fatalf("expected a new post without a status to be published, instead we got: %q (%v)", p.Status, err)
+	}
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const collNamePasswordReset = "password_resets"
+
+// PasswordResetTTL is the time a password reset token is valid for
+const PasswordResetTTL = time.Hour
+
+// PasswordReset lets the holder of its token set a new password of the user once before ExpiresAt.
+// Only the hash of the token is kept, the token itself is sent to the user by email
+type PasswordReset struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID       primitive.ObjectID `json:"user_id" bson:"user_id"`
+	TokenHash    string             `json:"-" bson:"token_hash"`
+	ExpiresAt    int64              `json:"expires_at" bson:"expires_at"`
+	CreationTime int64              `json:"creation_time" bson:"creation_time"`
+}
+
+// NewPasswordReset returns a password reset of the user along with its token
+func NewPasswordReset(userID primitive.ObjectID) (*PasswordReset, string, error) {
+	token, err := NewToken()
+	if err != nil {
+		return nil, "", err
+	}
+	return &PasswordReset{
+		UserID:    userID,
+		TokenHash: HashToken(token),
+		ExpiresAt: time.Now().Add(PasswordResetTTL).Unix(),
+	}, token, nil
+}
+
+type mongoPasswordResetStore struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoPasswordResetStore) Create(ctx context.Context, reset *PasswordReset) error {
+	reset.CreationTime = time.Now().Unix()
+	result, err := s.coll.InsertOne(ctx, reset)
+	if err != nil {
+		return err
+	}
+	if objectID, ok := result.InsertedID.(primitive.ObjectID); ok {
+		reset.ID = objectID
+		return nil
+	}
+	return errors.New("on retrieving undefined id type")
+}
+
+func (s *mongoPasswordResetStore) Use(ctx context.Context, tokenHash string, now int64) (*PasswordReset, error) {
+	reset := &PasswordReset{}
+	err := s.coll.FindOneAndDelete(ctx, bson.M{"token_hash": tokenHash}).Decode(reset)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if reset.ExpiresAt <= now {
+		return nil, ErrNotFound
+	}
+	return reset, nil
+}
+
+func (s *mongoPasswordResetStore) DeleteByUser(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.coll.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
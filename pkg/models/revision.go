@@ -0,0 +1,103 @@
+package models
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collNameRevision = "revisions"
+
+// Revision is a prior version of a post, kept whenever the post is changed
+type Revision struct {
+	ID       primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	PostID   primitive.ObjectID `json:"post_id" bson:"post_id"`
+	Rev      int64              `json:"rev" bson:"rev"`
+	Title    string             `json:"title" bson:"title"`
+	Content  string             `json:"content,omitempty" bson:"content"`
+	EditorID primitive.ObjectID `json:"editor_id" bson:"editor_id,omitempty"`
+	Time     int64              `json:"time" bson:"time"`
+}
+
+// NewRevision returns a revision holding the current version of p
+func NewRevision(p *Post) *Revision {
+	rev := &Revision{
+		PostID:   p.ID,
+		Title:    p.Title,
+		Content:  p.Content,
+		EditorID: p.EditorID,
+		Time:     p.LastEdited,
+	}
+	if rev.EditorID.IsZero() {
+		rev.EditorID = p.AuthorID
+	}
+	if rev.Time == 0 {
+		rev.Time = p.CreationTime
+	}
+	return rev
+}
+
+type mongoRevisionStore struct {
+	coll *mongo.Collection
+}
+
+// maxRevisionAttempts is how many times adding a revision is tried when concurrent ones take its number
+const maxRevisionAttempts = 5
+
+// Add numbers rev after the last revision of the post, the unique index of (post_id, rev) made by CreateIndexes
+// makes concurrent revisions of the post retry with the next number
+func (s *mongoRevisionStore) Add(ctx context.Context, rev *Revision) error {
+	for attempt := 1; ; attempt++ {
+		last := &Revision{}
+		opts := options.FindOne().SetSort(bson.M{"rev": -1}).SetProjection(bson.M{"rev": 1})
+		err := s.coll.FindOne(ctx, bson.M{"post_id": rev.PostID}, opts).Decode(last)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+		rev.Rev = last.Rev + 1
+		result, err := s.coll.InsertOne(ctx, rev)
+		if isDuplicateKey(err) && attempt < maxRevisionAttempts {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if objectID, ok := result.InsertedID.(primitive.ObjectID); ok {
+			rev.ID = objectID
+			return nil
+		}
+		return errors.New("on retrieving undefined id type")
+	}
+}
+
+func (s *mongoRevisionStore) List(ctx context.Context, postID primitive.ObjectID) ([]*Revision, error) {
+	opts := options.Find().SetSort(bson.M{"rev": -1}).SetProjection(bson.M{"content": 0})
+	cur, err := s.coll.Find(ctx, bson.M{"post_id": postID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	revs := make([]*Revision, 0)
+	if err := cur.All(ctx, &revs); err != nil {
+		return nil, err
+	}
+	return revs, nil
+}
+
+func (s *mongoRevisionStore) Get(ctx context.Context, postID primitive.ObjectID, rev int64) (*Revision, error) {
+	revision := &Revision{}
+	if err := s.coll.FindOne(ctx, bson.M{"post_id": postID, "rev": rev}).Decode(revision); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return revision, nil
+}
+
+func (s *mongoRevisionStore) DeleteByPost(ctx context.Context, postID primitive.ObjectID) error {
+	_, err := s.coll.DeleteMany(ctx, bson.M{"post_id": postID})
+	return err
+}
@@ -0,0 +1,72 @@
+package models
+
+import "errors"
+
+// Roles of users from the most to the least privileged
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleAuthor = "author"
+	RoleReader = "reader"
+)
+
+// Permission is an action which requires a user to have a certain role
+type Permission string
+
+const (
+	PermWritePosts       Permission = "write posts"   // create posts & change their own ones
+	PermEditAnyPost      Permission = "edit any post" // change & delete posts of other authors
+	PermModerateComments Permission = "moderate comments"
+	PermSkipModeration   Permission = "skip moderation" // comments are published without waiting for moderation
+	PermUploadFiles      Permission = "upload files"
+	PermDeleteFiles      Permission = "delete files"
+	PermManageUsers      Permission = "manage users"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleAdmin: {
+		PermWritePosts, PermEditAnyPost, PermModerateComments, PermSkipModeration,
+		PermUploadFiles, PermDeleteFiles, PermManageUsers,
+	},
+	RoleEditor: {
+		PermWritePosts, PermEditAnyPost, PermModerateComments, PermSkipModeration,
+		PermUploadFiles, PermDeleteFiles,
+	},
+	RoleAuthor: {PermWritePosts, PermSkipModeration, PermUploadFiles},
+	RoleReader: {},
+}
+
+// ValidateRole checks a role assigned to a user
+func ValidateRole(role string) error {
+	if _, ok := rolePermissions[role]; !ok {
+		return errors.New("on receiving an unknown role")
+	}
+	return nil
+}
+
+// EffectiveRole returns the role of u, accounts made before roles were introduced are readers
+// until an admin gives them another role
+func (u *User) EffectiveRole() string {
+	if u.Role == "" {
+		return RoleReader
+	}
+	return u.Role
+}
+
+// Can reports whether the role of u grants perm
+func (u *User) Can(perm Permission) bool {
+	for _, p := range rolePermissions[u.EffectiveRole()] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// CanEditPost reports whether u may change or delete p
+func (u *User) CanEditPost(p *Post) bool {
+	if u.Can(PermEditAnyPost) {
+		return true
+	}
+	return u.Can(PermWritePosts) && p.AuthorID == u.ID
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCanEditPost(t *testing.T) {
+	authorID := primitive.NewObjectID()
+	post := &Post{AuthorID: authorID}
+	cases := []struct {
+		user     *User
+		expected bool
+	}{
+		{&User{ID: authorID, Role: RoleAuthor}, true},
+		{&User{ID: primitive.NewObjectID(), Role: RoleAuthor}, false},
+		{&User{ID: authorID, Role: RoleReader}, false},
+		{&User{ID: primitive.NewObjectID(), Role: RoleEditor}, true},
+		{&User{ID: authorID}, false}, // accounts made before roles are readers
+	}
+	for _, c := range cases {
+		if got := c.user.CanEditPost(post); got != c.expected {
+			t.Fatalf("expected a user with role %q editing the post to be %v, instead we got: %v", c.user.Role, c.expected, got)
+		}
+	}
+	if (&User{}).Can(PermManageUsers) {
+		t.Fatal("expected an account without a role not to manage users")
+	}
+}
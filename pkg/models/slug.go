@@ -0,0 +1,102 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const maxSlugLen = 80
+
+// ErrSlugTaken is returned on setting a slug of a post which another post has (or had) already
+var ErrSlugTaken = errors.New("on receiving a slug which is already taken")
+
+// Slugify turns s into a lowercase string of letters, digits & dashes usable in URLs
+func Slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(r)
+			continue
+		}
+		dash = true
+	}
+	slug := b.String()
+	if len(slug) > maxSlugLen {
+		// Cutting at a rune boundary
+		slug = strings.ToValidUTF8(slug[:maxSlugLen], "")
+		slug = strings.TrimRight(slug, "-")
+	}
+	return slug
+}
+
+// UniqueSlug returns base (or "post" if it's empty) with the smallest numeric suffix
+// which makes it not taken by posts other than the one with exceptID
+func UniqueSlug(ctx context.Context, posts PostStore, base string, exceptID primitive.ObjectID) (string, error) {
+	if base == "" {
+		base = "post"
+	}
+	slug := base
+	for i := 2; ; i++ {
+		taken, err := posts.SlugTaken(ctx, slug, exceptID)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return slug, nil
+		}
+		slug = base + "-" + strconv.Itoa(i)
+	}
+}
+
+// ValidateSlug sets a unique slug of the post, prev is the post being updated or nil for a new one.
+// New posts get their slug from the requested one or the title, while edited slugs
+// must not be taken & the previous one is kept in OldSlugs to redirect from
+func (p *Post) ValidateSlug(ctx context.Context, posts PostStore, prev *Post) (err error) {
+	requested := Slugify(p.Slug)
+	if prev == nil {
+		if requested == "" {
+			requested = Slugify(p.Title)
+		}
+		p.Slug, err = UniqueSlug(ctx, posts, requested, primitive.NilObjectID)
+		return
+	}
+
+	p.OldSlugs = prev.OldSlugs
+	if requested == "" || requested == prev.Slug {
+		if prev.Slug != "" {
+			p.Slug = prev.Slug
+			return nil
+		}
+		// Posts created before slugs were introduced get one on their first update
+		p.Slug, err = UniqueSlug(ctx, posts, Slugify(p.Title), prev.ID)
+		return
+	}
+	taken, err := posts.SlugTaken(ctx, requested, prev.ID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrSlugTaken
+	}
+	p.Slug = requested
+	p.OldSlugs = make([]string, 0, len(prev.OldSlugs)+1)
+	for _, old := range prev.OldSlugs {
+		if old != requested {
+			p.OldSlugs = append(p.OldSlugs, old)
+		}
+	}
+	if prev.Slug != "" {
+		p.OldSlugs = append(p.OldSlugs, prev.Slug)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	cases := []struct {
+		in, expected string
+	}{
+		{"Hello, World!", "hello-world"},
+		{"  --Go 1.14: what's new?  ", "go-1-14-what-s-new"},
+		{"Привіт, світ", "привіт-світ"},
+		{"!!!", ""},
+		{strings.Repeat("ab ", 40), strings.TrimRight(strings.Repeat("ab-", 27), "-")},
+	}
+	for _, c := range cases {
+		if got := Slugify(c.in); got != c.expected {
+			t.Fatalf("with input %q expected %q, instead we got: %q", c.in, c.expected, got)
+		}
+	}
+}
@@ -1,23 +1,36 @@
 package models
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"io/ioutil"
+	"log"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-const collNameStatic = "files"
+const (
+	collNameStatic = "files"
+	// The contents of files are kept in GridFS (the "static.files" & "static.chunks" collections),
+	// so they aren't limited by the size of a document
+	bucketNameStatic = "static"
+)
 
 // File struct is a model for a files collection
 type File struct {
-	ID           primitive.ObjectID `bson:"_id,omitempty"`
-	Dir          string             `bson:"dir"`
-	Name         string             `bson:"name"`
-	Ext          string             `bson:"ext"`
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Dir       string             `bson:"dir"`
+	Name      string             `bson:"name"`
+	Ext       string             `bson:"ext"`
+	Size      int64              `bson:"size"`
+	ContentID primitive.ObjectID `bson:"content_id,omitempty"` // the contents of the file in chunked storage
+	// File holds the contents of files saved before they were kept in chunks
 	File         primitive.Binary   `bson:"file,omitempty"`
 	CreationTime primitive.DateTime `bson:"creation_time,omitempty"`
 }
@@ -31,56 +44,166 @@ func NewEmptyFile(dir, name, ext string) *File {
 	}
 }
 
-func NewFile(dir, name, ext string, data []byte) *File {
-	file := NewEmptyFile(dir, name, ext)
-	file.File.Data = data
-	return file
+// LegacyContent returns the contents of f if it was saved before the contents were kept in chunks,
+// f.Size is set to the length of them
+func (f *File) LegacyContent() (io.ReadCloser, bool) {
+	if !f.ContentID.IsZero() {
+		return nil, false
+	}
+	f.Size = int64(len(f.File.Data))
+	return ioutil.NopCloser(bytes.NewReader(f.File.Data)), true
 }
 
 func (s *File) getFilter() bson.M {
 	return bson.M{"dir": s.Dir, "name": s.Name, "ext": s.Ext}
 }
 
-// Save saves the file in DB
-func (s *File) Save(ctx context.Context) (*mongo.UpdateResult, error) {
-	update := bson.M{"$set": s}
-	opts := options.Update().SetUpsert(true)
+type mongoFileStore struct {
+	coll *mongo.Collection
+}
+
+// bucket returns the GridFS bucket of the contents of files,
+// a bucket is made for every operation since buckets can't be shared by concurrent uploads
+func (s *mongoFileStore) bucket() (*gridfs.Bucket, error) {
+	return gridfs.NewBucket(s.coll.Database(), options.GridFSBucket().SetName(bucketNameStatic))
+}
 
-	result, err := GetDB().Collection(collNameStatic).UpdateOne(ctx, s.getFilter(), update, opts)
+// Save streams content into GridFS, then points the record of the file at it
+// & deletes the contents the file had before (if any)
+func (s *mongoFileStore) Save(ctx context.Context, f *File, content io.Reader) (bool, error) {
+	bucket, err := s.bucket()
+	if err != nil {
+		return false, err
+	}
+	stream, err := bucket.OpenUploadStream(f.Name + "." + f.Ext)
+	if err != nil {
+		return false, err
+	}
+	upload := &uploadStream{UploadStream: stream, ctx: ctx}
+	size, err := io.Copy(upload, content)
+	if err != nil {
+		upload.Abort()
+		return false, err
+	}
+	if err := upload.Close(); err != nil {
+		bucket.Delete(upload.FileID)
+		return false, err
+	}
+	f.Size = size
+	f.ContentID = upload.FileID.(primitive.ObjectID)
+
+	var old File
+	update := bson.M{"$set": f, "$unset": bson.M{"file": ""}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetProjection(bson.M{"content_id": 1})
+	err = s.coll.FindOneAndUpdate(ctx, f.getFilter(), update, opts).Decode(&old)
+	if err == mongo.ErrNoDocuments {
+		return true, nil
+	}
+	if err != nil {
+		bucket.Delete(f.ContentID)
+		return false, err
+	}
+	if !old.ContentID.IsZero() {
+		if err := bucket.Delete(old.ContentID); err != nil {
+			log.Printf("on deleting the replaced contents of the file %s.%s: %s", f.Name, f.Ext, err.Error())
+		}
+	}
+	return false, nil
+}
+
+// Open fills f with the record of the file & returns a stream of its contents
+func (s *mongoFileStore) Open(ctx context.Context, f *File) (io.ReadCloser, error) {
+	if err := s.coll.FindOne(ctx, f.getFilter()).Decode(f); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if content, ok := f.LegacyContent(); ok {
+		return content, nil
+	}
+	bucket, err := s.bucket()
 	if err != nil {
 		return nil, err
 	}
-	return result, nil
+	stream, err := bucket.OpenDownloadStream(f.ContentID)
+	if err == gridfs.ErrFileNotFound {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &downloadStream{DownloadStream: stream, ctx: ctx}, nil
 }
 
-// Get fetches a binary of the file
-func (s *File) Get(ctx context.Context) error {
-	opts := options.FindOne().SetProjection(bson.D{{"file", 1}})
+// chunkTimeout limits the time a batch of chunks can take to be written or read,
+// streams of large files can't be limited as a whole
+const chunkTimeout = 30 * time.Second
 
-	if err := GetDB().Collection(collNameStatic).FindOne(ctx, s.getFilter(), opts).Decode(&s); err != nil {
-		return err
+// uploadStream extends the deadline of the stream before every write & stops once ctx is done
+type uploadStream struct {
+	*gridfs.UploadStream
+	ctx context.Context
+}
+
+func (s *uploadStream) Write(p []byte) (int, error) {
+	if err := s.ctx.Err(); err != nil {
+		return 0, err
 	}
-	return nil
+	s.SetWriteDeadline(time.Now().Add(chunkTimeout))
+	return s.UploadStream.Write(p)
+}
+
+func (s *uploadStream) Close() error {
+	s.SetWriteDeadline(time.Now().Add(chunkTimeout))
+	return s.UploadStream.Close()
 }
 
-// Delete alters the record of the file from DB
-func (s *File) Delete(ctx context.Context) (*mongo.DeleteResult, error) {
-	res, err := GetDB().Collection(collNameStatic).DeleteOne(ctx, s.getFilter())
+// downloadStream extends the deadline of the stream before every read & stops once ctx is done
+type downloadStream struct {
+	*gridfs.DownloadStream
+	ctx context.Context
+}
+
+func (s *downloadStream) Read(p []byte) (int, error) {
+	if err := s.ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.SetReadDeadline(time.Now().Add(chunkTimeout))
+	return s.DownloadStream.Read(p)
+}
+
+// Delete alters the record of the file from DB along with its contents
+func (s *mongoFileStore) Delete(ctx context.Context, f *File) error {
+	var old File
+	opts := options.FindOneAndDelete().SetProjection(bson.M{"content_id": 1})
+	if err := s.coll.FindOneAndDelete(ctx, f.getFilter(), opts).Decode(&old); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrNotFound
+		}
+		return err
+	}
+	if old.ContentID.IsZero() {
+		return nil
+	}
+	bucket, err := s.bucket()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return res, nil
+	if err := bucket.Delete(old.ContentID); err != nil && err != gridfs.ErrFileNotFound {
+		return err
+	}
+	return nil
 }
 
-// ListFilenamesWhere does what it should
-func ListFilenamesWhere(ctx context.Context, dir, ext string) ([]string, error) {
+// ListFilenames does what it should
+func (s *mongoFileStore) ListFilenames(ctx context.Context, dir, ext string) ([]string, error) {
 	filter := bson.M{"dir": dir}
 	if ext != "*" {
 		filter["ext"] = ext
 	}
-	opts := options.Find().SetProjection(bson.D{{"name", 1}, {"ext", 1}})
+	opts := options.Find().SetProjection(bson.M{"name": 1, "ext": 1})
 
-	cur, err := GetDB().Collection(collNameStatic).Find(ctx, filter, opts)
+	cur, err := s.coll.Find(ctx, filter, opts)
 	if err != nil {
 		return nil, err
 	}
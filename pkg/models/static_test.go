@@ -3,33 +3,55 @@ package models
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 	"time"
 )
 
+var mongoStores *Stores
+
+// fileStore returns a store backed by MongoDB from DB_URI & DB_NAME env variables,
+// tests are skipped when those aren't set
+func fileStore(t *testing.T) FileStore {
+	if mongoStores == nil {
+		uri, name := os.Getenv("DB_URI"), os.Getenv("DB_NAME")
+		if uri == "" || name == "" {
+			t.Skip("DB_URI and DB_NAME are required to run tests against MongoDB")
+		}
+		db, err := ConnectMongo(uri, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mongoStores = NewMongoStores(db)
+	}
+	return mongoStores.Files
+}
+
 func mockName() string {
 	return fmt.Sprintf("%d", time.Now().UnixNano())
 }
 
-func createMockedFile(t *testing.T) *File {
+func createMockedFile(t *testing.T, files FileStore) *File {
 	mockedFile := NewEmptyFile("/test", mockName(), "custom")
-	if _, err := mockedFile.Save(context.TODO()); err != nil {
+	if _, err := files.Save(context.TODO(), mockedFile, strings.NewReader("content")); err != nil {
 		t.Errorf("on saving a mocking file (%v) in db: %s", mockedFile, err.Error())
 	}
 	return mockedFile
 }
 
-func cleanMockedFile(t *testing.T, f *File) {
-	if _, err := f.Delete(context.TODO()); err != nil {
+func cleanMockedFile(t *testing.T, files FileStore, f *File) {
+	if err := files.Delete(context.TODO(), f); err != nil {
 		t.Errorf("on deleting the file (%v) from db: %s", f, err.Error())
 	}
 }
 
 func TestSave(t *testing.T) {
+	files := fileStore(t)
 	type (
 		out struct {
-			modifedCount  int64
-			upsertedCount int64
+			created bool
 		}
 		template struct {
 			in       *File
@@ -38,18 +60,20 @@ func TestSave(t *testing.T) {
 	)
 	cases := make([]template, 2)
 	filename := mockName()
-	cases[0] = template{NewEmptyFile("/test", filename, "custom"), out{0, 1}}
+	cases[0] = template{NewEmptyFile("/test", filename, "custom"), out{true}}
 	time.Sleep(5 * time.Millisecond)
-	cases[1] = template{NewEmptyFile("/test", filename, "custom"), out{1, 0}}
+	cases[1] = template{NewEmptyFile("/test", filename, "custom"), out{false}}
 
 	for _, c := range cases {
-		r, err := c.in.Save(context.TODO())
+		created, err := files.Save(context.TODO(), c.in, strings.NewReader("content"))
 		if err != nil {
 			t.Fatalf("on saving a file to the db: %s", err.Error())
 		}
-		defer cleanMockedFile(t, c.in)
+		if created {
+			defer cleanMockedFile(t, files, c.in)
+		}
 
-		got := out{r.ModifiedCount, r.UpsertedCount}
+		got := out{created}
 
 		if got != c.expected {
 			t.Fatalf("with input %#v the expected output had to be: %v, insted we got: %v",
@@ -58,27 +82,36 @@ func TestSave(t *testing.T) {
 	}
 }
 
-func TestGet(t *testing.T) {
+func TestOpen(t *testing.T) {
+	files := fileStore(t)
 	for i := 0; i < 10; i++ {
-		f := createMockedFile(t)
-		defer cleanMockedFile(t, f)
-		if err := f.Get(context.TODO()); err != nil {
-			t.Fatalf("on getting a mocked record from db: %s", err.Error())
+		f := createMockedFile(t, files)
+		defer cleanMockedFile(t, files, f)
+		content, err := files.Open(context.TODO(), f)
+		if err != nil {
+			t.Fatalf("on opening a mocked record from db: %s", err.Error())
+		}
+		data, err := ioutil.ReadAll(content)
+		content.Close()
+		if err != nil || string(data) != "content" {
+			t.Fatalf("on reading the contents of a mocked record: %q, %v", data, err)
 		}
 	}
 }
 
 func TestDelete(t *testing.T) {
-	file := createMockedFile(t)
-	cleanMockedFile(t, file)
+	files := fileStore(t)
+	file := createMockedFile(t, files)
+	cleanMockedFile(t, files, file)
 }
 
 func TestListFilenamesWhere(t *testing.T) {
+	files := fileStore(t)
 	for i := 0; i < 10; i++ {
-		f := createMockedFile(t)
-		defer cleanMockedFile(t, f)
+		f := createMockedFile(t, files)
+		defer cleanMockedFile(t, files, f)
 	}
-	if filenames, err := ListFilenamesWhere(context.TODO(), "/test", "custom"); err != nil {
+	if filenames, err := files.ListFilenames(context.TODO(), "/test", "custom"); err != nil {
 		t.Fatalf("on getting filenames slice from db: %s", err.Error())
 	} else if len(filenames) != 10 {
 		t.Fatal("on getting a wrong length data, expected 10 records")
@@ -0,0 +1,219 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrNotFound is returned by stores when a requested record doesn't exist
+var ErrNotFound = errors.New("the resource was not found")
+
+// ErrCodeUsed is returned by UserStore.UseTOTP when the code of the second factor has been used concurrently
+var ErrCodeUsed = errors.New("on using a code of the second factor which is used already")
+
+// PostStore is an interface to the storage of posts
+type PostStore interface {
+	// Save & Update return ErrSlugTaken if another post has the slug of p, even if it was checked before
+	Save(ctx context.Context, p *Post) error
+	Update(ctx context.Context, p *Post) error
+	DeleteByID(ctx context.Context, id string) error
+	GetByID(ctx context.Context, id string) (*Post, error)
+	// GetBySlug returns the post with the given current or old slug
+	GetBySlug(ctx context.Context, slug string) (*Post, error)
+	// SlugTaken reports whether slug is the current or an old slug of any post except the one with exceptID
+	SlugTaken(ctx context.Context, slug string, exceptID primitive.ObjectID) (bool, error)
+	Count(ctx context.Context, filter PostFilter) (int64, error)
+	List(ctx context.Context, q PostsQuery) ([]*PostWithAuthor, error)
+	// Tags returns every tag of the posts matching filter along with the number of posts having it
+	Tags(ctx context.Context, filter PostFilter) ([]*TagCount, error)
+	// PublishDue publishes scheduled posts with PublishAt not later than now & returns them
+	PublishDue(ctx context.Context, now int64) ([]*Post, error)
+}
+
+// UserStore is an interface to the storage of user accounts
+type UserStore interface {
+	Create(ctx context.Context, u *User) error
+	Update(ctx context.Context, u *User) error
+	DeleteByID(ctx context.Context, id primitive.ObjectID) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*User, error)
+	GetByName(ctx context.Context, name string) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	Count(ctx context.Context) (int64, error)
+	CountByRole(ctx context.Context, role string) (int64, error)
+	// SetTOTP replaces the second factor of the user, nil disables it
+	SetTOTP(ctx context.Context, id primitive.ObjectID, t *TOTP) error
+	// UseTOTP replaces the second factor of the user prev with next where a code is marked as used,
+	// atomically: ErrCodeUsed is returned if the stored one isn't prev anymore (a code was used since)
+	UseTOTP(ctx context.Context, id primitive.ObjectID, prev, next *TOTP) error
+}
+
+// FileStore is an interface to the storage of static files
+type FileStore interface {
+	// Save streams content into the file replacing the one with the same dir, name & ext or creating a new one,
+	// the old contents are kept if reading content fails; created reports which of these happened
+	Save(ctx context.Context, f *File, content io.Reader) (created bool, err error)
+	// Open fills f with the record of the file matching f's dir, name & ext
+	// & returns a stream of its contents which has to be closed
+	Open(ctx context.Context, f *File) (io.ReadCloser, error)
+	Delete(ctx context.Context, f *File) error
+	// ListFilenames returns "name.ext" of files in dir; ext "*" matches any extension
+	ListFilenames(ctx context.Context, dir, ext string) ([]string, error)
+}
+
+// RevisionStore is an interface to the storage of prior versions of posts
+type RevisionStore interface {
+	// Add saves rev numbering it after the latest revision of its post
+	Add(ctx context.Context, rev *Revision) error
+	// List returns revisions of the post, newest first & without their content
+	List(ctx context.Context, postID primitive.ObjectID) ([]*Revision, error)
+	Get(ctx context.Context, postID primitive.ObjectID, rev int64) (*Revision, error)
+	DeleteByPost(ctx context.Context, postID primitive.ObjectID) error
+}
+
+// CommentStore is an interface to the storage of comments on posts
+type CommentStore interface {
+	Create(ctx context.Context, c *Comment) error
+	GetByID(ctx context.Context, id string) (*Comment, error)
+	Count(ctx context.Context, filter CommentFilter) (int64, error)
+	// List returns a page of comments from the oldest to the newest
+	List(ctx context.Context, q CommentsQuery) ([]*Comment, error)
+	SetStatus(ctx context.Context, id primitive.ObjectID, status string) error
+	// DeleteByID removes the comment along with all the replies to it
+	DeleteByID(ctx context.Context, id primitive.ObjectID) error
+	DeleteByPost(ctx context.Context, postID primitive.ObjectID) error
+}
+
+// InviteStore is an interface to the storage of invites to sign up
+type InviteStore interface {
+	Create(ctx context.Context, inv *Invite) error
+	List(ctx context.Context) ([]*Invite, error)
+	DeleteByID(ctx context.Context, id primitive.ObjectID) error
+	// Use counts a use of the invite with tokenHash & returns it,
+	// ErrNotFound is returned if there is no such invite or it has expired or been used up
+	Use(ctx context.Context, tokenHash string, now int64) (*Invite, error)
+}
+
+// PasswordResetStore is an interface to the storage of password reset tokens
+type PasswordResetStore interface {
+	Create(ctx context.Context, reset *PasswordReset) error
+	// Use removes the reset with tokenHash & returns it,
+	// ErrNotFound is returned if there is no such reset or it has expired
+	Use(ctx context.Context, tokenHash string, now int64) (*PasswordReset, error)
+	DeleteByUser(ctx context.Context, userID primitive.ObjectID) error
+}
+
+// APITokenStore is an interface to the storage of personal API tokens
+type APITokenStore interface {
+	Create(ctx context.Context, t *APIToken) error
+	ListByUser(ctx context.Context, userID primitive.ObjectID) ([]*APIToken, error)
+	// Delete removes the token with id if it belongs to the user
+	Delete(ctx context.Context, userID, id primitive.ObjectID) error
+	DeleteByUser(ctx context.Context, userID primitive.ObjectID) error
+	// Use records the time the token with tokenHash is used at & returns it,
+	// ErrNotFound is returned if there is no such token or it has expired
+	Use(ctx context.Context, tokenHash string, now int64) (*APIToken, error)
+}
+
+// LockoutStore is an interface to the audit log of login lockouts
+type LockoutStore interface {
+	Create(ctx context.Context, l *Lockout) error
+	// List returns up to limit of the latest lockouts, newest first
+	List(ctx context.Context, limit int64) ([]*Lockout, error)
+}
+
+// PostSearcher is an interface to the full-text search over posts
+type PostSearcher interface {
+	Search(ctx context.Context, q SearchQuery) (*SearchResult, error)
+}
+
+// Stores groups the storage our handlers depend on
+type Stores struct {
+	Posts     PostStore
+	Users     UserStore
+	Files     FileStore
+	Revisions RevisionStore
+	Comments  CommentStore
+	Invites   InviteStore
+	Resets    PasswordResetStore
+	Tokens    APITokenStore
+	Lockouts  LockoutStore
+	Search    PostSearcher
+}
+
+// PostFilter narrows down the posts to be counted or listed, zero value matches all posts
+type PostFilter struct {
+	Tag string
+	// VisibleAt (unix), if set, keeps only the posts published by that time
+	// & any posts authored by ViewerID
+	VisibleAt int64
+	ViewerID  primitive.ObjectID
+}
+
+// Matches reports whether p passes the filter
+func (f PostFilter) Matches(p *Post) bool {
+	if f.Tag != "" && !p.HasTag(f.Tag) {
+		return false
+	}
+	if f.VisibleAt != 0 && !p.IsVisible(f.VisibleAt, f.ViewerID) {
+		return false
+	}
+	return true
+}
+
+// CreatePostFilter builds a filter from request's parameters
+func CreatePostFilter(r *http.Request) PostFilter {
+	return PostFilter{
+		Tag: normalizeTag(r.URL.Query().Get("tag")),
+	}
+}
+
+// PostsQuery describes a page of posts to be listed
+type PostsQuery struct {
+	Filter      PostFilter
+	PageSize    int64
+	PageNum     int64
+	OldestFirst bool
+}
+
+// Skip returns the number of posts preceding the requested page
+func (q PostsQuery) Skip() int64 {
+	return (q.PageNum - 1) * q.PageSize
+}
+
+// CreatePostsQuery builds a query for a page of posts from request's parameters.
+// Posts go from the most recently published to the oldest, unless "sortByDate=desc" is passed
+// (the name is kept for compatibility with the client)
+func CreatePostsQuery(r *http.Request, pageSize, pageNum int64) PostsQuery {
+	return PostsQuery{
+		Filter:      CreatePostFilter(r),
+		PageSize:    pageSize,
+		PageNum:     pageNum,
+		OldestFirst: r.URL.Query().Get("sortByDate") == "desc",
+	}
+}
+
+// SearchQuery describes a page of posts matching Text to be found
+type SearchQuery struct {
+	Text     string
+	Filter   PostFilter
+	PageSize int64
+	PageNum  int64
+}
+
+// SearchResult is a page of posts found along with the total number of them
+type SearchResult struct {
+	Total int64        `json:"total"`
+	Hits  []*SearchHit `json:"hits"`
+}
+
+// SearchHit is a post found, its title & a snippet of its content have matches wrapped in <mark> tags
+type SearchHit struct {
+	Post    *Post   `json:"post"`
+	Score   float64 `json:"score"`
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet"`
+}
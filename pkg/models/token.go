@@ -0,0 +1,162 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collNameAPIToken = "api_tokens"
+
+const (
+	maxAPITokenName = 50
+	maxAPITokenTTL  = 365 * 24 * time.Hour
+)
+
+// Scopes of API tokens, a token is allowed only the actions of its scopes
+// which are permitted to the role of its owner as well
+const (
+	ScopePostsWrite       = "posts:write"
+	ScopeFilesWrite       = "files:write"
+	ScopeCommentsModerate = "comments:moderate"
+)
+
+var scopePermissions = map[string][]Permission{
+	ScopePostsWrite:       {PermWritePosts, PermEditAnyPost},
+	ScopeFilesWrite:       {PermUploadFiles, PermDeleteFiles},
+	ScopeCommentsModerate: {PermModerateComments},
+}
+
+// APIToken lets scripts act on behalf of the user by passing its token in the Authorization header.
+// Only the hash of the token is kept, the token itself is shown once on creation
+type APIToken struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID       primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Name         string             `json:"name" bson:"name"`
+	TokenHash    string             `json:"-" bson:"token_hash"`
+	Scopes       []string           `json:"scopes" bson:"scopes"`
+	ExpiresAt    int64              `json:"expires_at" bson:"expires_at"` // zero if the token never expires
+	LastUsed     int64              `json:"last_used" bson:"last_used"`
+	CreationTime int64              `json:"creation_time" bson:"creation_time"`
+}
+
+// NewAPIToken returns a token of the user which expires after ttl (never if it's zero)
+// along with the token itself
+func NewAPIToken(userID primitive.ObjectID, name string, scopes []string, ttl time.Duration) (*APIToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxAPITokenName {
+		return nil, "", fmt.Errorf("on receiving a token name which is empty or longer than %d chars", maxAPITokenName)
+	}
+	if len(scopes) == 0 {
+		return nil, "", errors.New("on receiving a token without scopes")
+	}
+	for _, scope := range scopes {
+		if _, ok := scopePermissions[scope]; !ok {
+			return nil, "", fmt.Errorf("on receiving an unknown token scope: %q", scope)
+		}
+	}
+	if ttl < 0 || ttl > maxAPITokenTTL {
+		return nil, "", errors.New("on receiving a token lifetime which is negative or longer than a year")
+	}
+	token, err := NewToken()
+	if err != nil {
+		return nil, "", err
+	}
+	t := &APIToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: HashToken(token),
+		Scopes:    scopes,
+	}
+	if ttl != 0 {
+		t.ExpiresAt = time.Now().Add(ttl).Unix()
+	}
+	return t, token, nil
+}
+
+// Allows reports whether any of the token's scopes grants perm
+func (t *APIToken) Allows(perm Permission) bool {
+	for _, scope := range t.Scopes {
+		for _, p := range scopePermissions[scope] {
+			if p == perm {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsExpired reports whether the token can't be used at now (unix)
+func (t *APIToken) IsExpired(now int64) bool {
+	return t.ExpiresAt != 0 && t.ExpiresAt <= now
+}
+
+type mongoAPITokenStore struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoAPITokenStore) Create(ctx context.Context, t *APIToken) error {
+	t.CreationTime = time.Now().Unix()
+	result, err := s.coll.InsertOne(ctx, t)
+	if err != nil {
+		return err
+	}
+	if objectID, ok := result.InsertedID.(primitive.ObjectID); ok {
+		t.ID = objectID
+		return nil
+	}
+	return errors.New("on retrieving undefined id type")
+}
+
+func (s *mongoAPITokenStore) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]*APIToken, error) {
+	cur, err := s.coll.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.M{"creation_time": -1}))
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]*APIToken, 0)
+	if err := cur.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (s *mongoAPITokenStore) Delete(ctx context.Context, userID, id primitive.ObjectID) error {
+	result, err := s.coll.DeleteOne(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoAPITokenStore) DeleteByUser(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.coll.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+func (s *mongoAPITokenStore) Use(ctx context.Context, tokenHash string, now int64) (*APIToken, error) {
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"$or":        bson.A{bson.M{"expires_at": 0}, bson.M{"expires_at": bson.M{"$gt": now}}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	t := &APIToken{}
+	err := s.coll.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"last_used": now}}, opts).Decode(t)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/totp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const numOfRecoveryCodes = 10
+
+// TOTP holds the second factor of logging in of a user, it's enabled once the first code is confirmed
+type TOTP struct {
+	Secret  string `bson:"secret"`
+	Enabled bool   `bson:"enabled"`
+	// LastStep is the period of the last code used, codes can't be used twice
+	LastStep int64 `bson:"last_step"`
+	// RecoveryCodes are hashes of single-use codes replacing TOTP codes if the authenticator is lost
+	RecoveryCodes []string `bson:"recovery_codes"`
+}
+
+// HasTwoFactor reports whether logging in as u requires a second factor
+func (u *User) HasTwoFactor() bool {
+	return u.TOTP != nil && u.TOTP.Enabled
+}
+
+// NewRecoveryCodes sets new recovery codes of t & returns them
+func (t *TOTP) NewRecoveryCodes() ([]string, error) {
+	codes := make([]string, numOfRecoveryCodes)
+	t.RecoveryCodes = make([]string, numOfRecoveryCodes)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes[i] = code[:4] + "-" + code[4:]
+		t.RecoveryCodes[i] = HashToken(codes[i])
+	}
+	return codes, nil
+}
+
+// Verify checks a TOTP or recovery code at time now, the code is marked as used if it's valid
+func (t *TOTP) Verify(code string, now time.Time) bool {
+	if step, ok := totp.Validate(t.Secret, code, now, t.LastStep); ok {
+		t.LastStep = step
+		return true
+	}
+	hash := HashToken(strings.ToLower(strings.TrimSpace(code)))
+	for i, h := range t.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+			t.RecoveryCodes = append(t.RecoveryCodes[:i:i], t.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *mongoUserStore) SetTOTP(ctx context.Context, id primitive.ObjectID, t *TOTP) error {
+	update := bson.M{"$set": bson.M{"totp": t}}
+	if t == nil {
+		update = bson.M{"$unset": bson.M{"totp": ""}}
+	}
+	result, err := s.coll.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoUserStore) UseTOTP(ctx context.Context, id primitive.ObjectID, prev, next *TOTP) error {
+	filter := bson.M{
+		"_id":                 id,
+		"totp.enabled":        prev.Enabled,
+		"totp.last_step":      prev.LastStep,
+		"totp.recovery_codes": prev.RecoveryCodes,
+	}
+	result, err := s.coll.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"totp": next}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrCodeUsed
+	}
+	return nil
+}
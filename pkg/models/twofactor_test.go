@@ -0,0 +1,41 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/totp"
+)
+
+func TestVerifyTOTP(t *testing.T) {
+	secret, err := totp.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tf := &TOTP{Secret: secret, Enabled: true}
+	recovery, err := tf.NewRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	code, err := totp.Code(secret, totp.Step(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tf.Verify(code, now) {
+		t.Fatal("expected a current code to be accepted")
+	}
+	if tf.Verify(code, now) {
+		t.Fatal("expected a code to be rejected once it was used")
+	}
+	if !tf.Verify(recovery[0], now) {
+		t.Fatal("expected a recovery code to be accepted")
+	}
+	if tf.Verify(recovery[0], now) {
+		t.Fatal("expected a recovery code to be rejected once it was used")
+	}
+	if len(tf.RecoveryCodes) != len(recovery)-1 {
+		t.Fatalf("expected %d recovery codes to be left, instead we got: %d", len(recovery)-1, len(tf.RecoveryCodes))
+	}
+}
@@ -3,12 +3,13 @@ package models
 import (
 	"context"
 	"errors"
+	"net/mail"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -18,17 +19,22 @@ type User struct {
 	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	Name         string             `json:"name" bson:"name,omitempty"`
 	Password     string             `json:"password" bson:"password,omitempty"`
+	Email        string             `json:"email" bson:"email,omitempty"`
+	Role         string             `json:"role" bson:"role,omitempty"`
 	CreationTime int64              `json:"creation_time" bson:"creation_time,omitempty"`
+	// SessionsValidFrom (unix nano) revokes the sessions the user logged in before that time
+	SessionsValidFrom int64 `json:"-" bson:"sessions_valid_from,omitempty"`
+	// TOTP is changed by UserStore.SetTOTP only
+	TOTP *TOTP `json:"-" bson:"totp,omitempty"`
 }
 
-func (u *User) Update(ctx context.Context) (err error) {
-	if u.Password != "" {
-		if u.Password, err = hashPassword(u.Password); err != nil {
-			return
-		}
-	}
+type mongoUserStore struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoUserStore) Update(ctx context.Context, u *User) (err error) {
 	u.CreationTime = 0
-	_, err = db.Collection(collNameUser).UpdateOne(
+	_, err = s.coll.UpdateOne(
 		ctx,
 		bson.M{"_id": u.ID},
 		bson.M{"$set": u},
@@ -36,13 +42,9 @@ func (u *User) Update(ctx context.Context) (err error) {
 	return
 }
 
-func (u *User) Create(ctx context.Context) error {
-	var err error
-	if u.Password, err = hashPassword(u.Password); err != nil {
-		return err
-	}
+func (s *mongoUserStore) Create(ctx context.Context, u *User) error {
 	u.CreationTime = time.Now().Unix()
-	result, err := db.Collection(collNameUser).InsertOne(ctx, u)
+	result, err := s.coll.InsertOne(ctx, u)
 	if err != nil {
 		return err
 	}
@@ -53,30 +55,55 @@ func (u *User) Create(ctx context.Context) error {
 	return errors.New("on retrieving undefined id type")
 }
 
-func DeleteUserByID(ctx context.Context, id primitive.ObjectID) (err error) {
-	_, err = db.Collection(collNameUser).DeleteOne(ctx, bson.D{{"_id", id}})
+func (s *mongoUserStore) DeleteByID(ctx context.Context, id primitive.ObjectID) (err error) {
+	_, err = s.coll.DeleteOne(ctx, bson.M{"_id": id})
 	return
 }
 
-func (u *User) Get(ctx context.Context) error {
-	//ctx, _ = context.WithTimeout(ctx, 3*time.Second)
-	return db.Collection(collNameUser).FindOne(ctx, bson.D{{"name", u.Name}}).Decode(u)
+func (s *mongoUserStore) Count(ctx context.Context) (int64, error) {
+	return s.coll.CountDocuments(ctx, bson.M{})
+}
+
+func (s *mongoUserStore) CountByRole(ctx context.Context, role string) (int64, error) {
+	return s.coll.CountDocuments(ctx, bson.M{"role": role})
 }
 
-func GetUserInfoByName(ctx context.Context, name string) (*User, error) {
+func (s *mongoUserStore) GetByID(ctx context.Context, id primitive.ObjectID) (*User, error) {
+	return s.findOne(ctx, bson.M{"_id": id})
+}
+
+func (s *mongoUserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
+	return s.findOne(ctx, bson.M{"email": email})
+}
+
+func (s *mongoUserStore) GetByName(ctx context.Context, name string) (*User, error) {
+	return s.findOne(ctx, bson.M{"name": name})
+}
+
+func (s *mongoUserStore) findOne(ctx context.Context, filter bson.M) (*User, error) {
 	user := &User{}
-	opts := options.FindOne().SetProjection(bson.D{
-		{"_id", 0},
-		{"password", 0},
-		{"creation_time", 0},
-	}) // mark by 0 to exclude a field
-	err := db.Collection(collNameUser).FindOne(ctx, bson.D{{"name", name}}, opts).Decode(user)
-	if err != nil {
+	if err := s.coll.FindOne(ctx, filter).Decode(user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
 		return nil, err
 	}
 	return user, nil
 }
 
+// HashPassword replaces a plain-text password of u (if any) with its hash
+func (u *User) HashPassword() (err error) {
+	if u.Password != "" {
+		u.Password, err = hashPassword(u.Password)
+	}
+	return
+}
+
+// PublicInfo returns a copy of u with only the fields that can be shown to anyone
+func (u *User) PublicInfo() *User {
+	return &User{Name: u.Name}
+}
+
 func CompareHashAndPassword(hash, password string) (bool, error) {
 	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
 		if err == bcrypt.ErrMismatchedHashAndPassword {
@@ -103,20 +130,20 @@ func (u *User) ValidateLoginForm() error {
 	return u.ValidatePassword()
 }
 
-func (u *User) ValidateSignupForm(ctx context.Context) error {
+func (u *User) ValidateSignupForm(ctx context.Context, users UserStore) error {
 	if err := u.ValidateName(); err != nil {
 		return err
 	}
 	if err := u.ValidatePassword(); err != nil {
 		return err
 	}
-	if !u.IsNameUnique(ctx) {
+	if !u.IsNameUnique(ctx, users) {
 		return errors.New("on receiving not a unique username")
 	}
-	return nil
+	return u.validateEmail(ctx, users)
 }
 
-func (u *User) ValidateUpdateForm(ctx context.Context) error {
+func (u *User) ValidateUpdateForm(ctx context.Context, users UserStore) error {
 	switch {
 	case u.Password != "":
 		if err := u.ValidatePassword(); err != nil {
@@ -126,11 +153,11 @@ func (u *User) ValidateUpdateForm(ctx context.Context) error {
 		if err := u.ValidateName(); err != nil {
 			return err
 		}
-		if !u.IsNameUnique(ctx) {
+		if !u.IsNameUnique(ctx, users) {
 			return errors.New("on receiving not a unique username")
 		}
 	}
-	return nil
+	return u.validateEmail(ctx, users)
 }
 
 func (u *User) ValidateName() error {
@@ -147,9 +174,25 @@ func (u *User) ValidatePassword() error {
 	return nil
 }
 
-func (u *User) IsNameUnique(ctx context.Context) bool {
-	tempUser := &User{Name: u.Name}
-	if err := tempUser.Get(ctx); err == mongo.ErrNoDocuments {
+// validateEmail normalizes an optional email of u & checks that it's not taken
+func (u *User) validateEmail(ctx context.Context, users UserStore) error {
+	if u.Email == "" {
+		return nil
+	}
+	addr, err := mail.ParseAddress(u.Email)
+	if err != nil || addr.Name != "" {
+		return errors.New("on receiving an invalid email")
+	}
+	u.Email = strings.ToLower(addr.Address)
+	owner, err := users.GetByEmail(ctx, u.Email)
+	if err == nil && owner.ID != u.ID || err != nil && err != ErrNotFound {
+		return errors.New("on receiving not a unique email")
+	}
+	return nil
+}
+
+func (u *User) IsNameUnique(ctx context.Context, users UserStore) bool {
+	if _, err := users.GetByName(ctx, u.Name); err == ErrNotFound {
 		return true
 	}
 	return false
@@ -165,4 +208,13 @@ func (u *User) Assign(newUser *User) {
 	if newUser.Password != "" {
 		u.Password = newUser.Password
 	}
+	if newUser.Email != "" {
+		u.Email = newUser.Email
+	}
+	if newUser.Role != "" {
+		u.Role = newUser.Role
+	}
+	if newUser.SessionsValidFrom != 0 {
+		u.SessionsValidFrom = newUser.SessionsValidFrom
+	}
 }
@@ -0,0 +1,142 @@
+// Package search implements the full-text search over posts with an in-process inverted index,
+// so it works on top of any storage backend
+package search
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/meddion/web-blog/pkg/models"
+)
+
+const (
+	titleWeight = 3 // a term in the title counts as many times as in the content
+	// BM25 parameters
+	k1 = 1.2
+	b  = 0.75
+)
+
+// Index maps terms to the posts containing them
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[string]*doc
+	postings map[string]map[string]float64 // term -> post ID -> weighted term frequency
+	totalLen float64
+}
+
+type doc struct {
+	post   *models.Post
+	terms  []string
+	length float64
+}
+
+// NewIndex returns an empty Index
+func NewIndex() *Index {
+	return &Index{
+		docs:     make(map[string]*doc),
+		postings: make(map[string]map[string]float64),
+	}
+}
+
+// Add indexes p replacing the previous version of it (if any)
+func (idx *Index) Add(p *models.Post) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	id := p.ID.Hex()
+	idx.remove(id)
+
+	freqs := make(map[string]float64)
+	for _, t := range tokenize(p.Title) {
+		freqs[t.term] += titleWeight
+	}
+	for _, t := range tokenize(p.Content) {
+		freqs[t.term]++
+	}
+	post := *p
+	d := &doc{post: &post}
+	for term, freq := range freqs {
+		if idx.postings[term] == nil {
+			idx.postings[term] = make(map[string]float64)
+		}
+		idx.postings[term][id] = freq
+		d.terms = append(d.terms, term)
+		d.length += freq
+	}
+	idx.docs[id] = d
+	idx.totalLen += d.length
+}
+
+// Remove drops the post with the given ID from the index
+func (idx *Index) Remove(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(id)
+}
+
+func (idx *Index) remove(id string) {
+	d, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	for _, term := range d.terms {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	idx.totalLen -= d.length
+	delete(idx.docs, id)
+}
+
+// Search returns a page of posts passing the filter ranked by their relevance to the query (BM25)
+func (idx *Index) Search(ctx context.Context, q models.SearchQuery) (*models.SearchResult, error) {
+	terms := queryTerms(q.Text)
+
+	idx.mu.RLock()
+	scores := make(map[string]float64)
+	n := float64(len(idx.docs))
+	avgLen := idx.totalLen / math.Max(n, 1)
+	for term := range terms {
+		posting := idx.postings[term]
+		df := float64(len(posting))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, freq := range posting {
+			norm := freq + k1*(1-b+b*idx.docs[id].length/avgLen)
+			scores[id] += idf * freq * (k1 + 1) / norm
+		}
+	}
+	var hits []*models.SearchHit
+	for id, score := range scores {
+		if post := idx.docs[id].post; q.Filter.Matches(post) {
+			hits = append(hits, &models.SearchHit{Post: post, Score: score})
+		}
+	}
+	idx.mu.RUnlock()
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Post.PublicationTime() > hits[j].Post.PublicationTime()
+	})
+	result := &models.SearchResult{Total: int64(len(hits)), Hits: make([]*models.SearchHit, 0)}
+	skip := (q.PageNum - 1) * q.PageSize
+	if skip < 0 || skip >= int64(len(hits)) {
+		return result, nil
+	}
+	hits = hits[skip:]
+	if int64(len(hits)) > q.PageSize {
+		hits = hits[:q.PageSize]
+	}
+	for _, hit := range hits {
+		post := *hit.Post
+		hit.Title = highlight(post.Title, terms)
+		hit.Snippet = snippet(post.Content, terms)
+		post.Content, post.ContentHTML, post.TOC = "", "", nil
+		hit.Post = &post
+	}
+	result.Hits = hits
+	return result, nil
+}
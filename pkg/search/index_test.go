@@ -0,0 +1,73 @@
+package search
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/meddion/web-blog/pkg/models"
+	"github.com/meddion/web-blog/pkg/models/memory"
+)
+
+func search(t *testing.T, stores *models.Stores, text string) *models.SearchResult {
+	result, err := stores.Search.Search(context.TODO(), models.SearchQuery{
+		Text:     text,
+		Filter:   models.PostFilter{VisibleAt: 1 << 40},
+		PageSize: 10,
+		PageNum:  1,
+	})
+	if err != nil {
+		t.Fatalf("on searching %q: %s", text, err.Error())
+	}
+	return result
+}
+
+func TestSearch(t *testing.T) {
+	stores := memory.NewStores()
+	stores.Posts.Save(context.TODO(), &models.Post{Title: "Cooking", Content: "Go <b>gophers</b> like pasta"})
+	if err := Attach(context.TODO(), stores); err != nil {
+		t.Fatalf("on attaching an index: %s", err.Error())
+	}
+	inTitle := &models.Post{Title: "Gophers", Content: "All about them"}
+	draft := &models.Post{Title: "Gophers", Status: models.StatusDraft}
+	for _, p := range []*models.Post{inTitle, draft} {
+		if err := stores.Posts.Save(context.TODO(), p); err != nil {
+			t.Fatalf("on saving a post: %s", err.Error())
+		}
+	}
+
+	result := search(t, stores, "the GOPHERS")
+	if result.Total != 2 || result.Hits[0].Post.ID != inTitle.ID {
+		t.Fatalf("expected 2 hits with the title match first, instead we got: %v", result.Hits)
+	}
+	if got := result.Hits[0].Title; got != "<mark>Gophers</mark>" {
+		t.Fatalf("on getting a wrongly highlighted title: %s", got)
+	}
+	if got := result.Hits[1].Snippet; got != "Go &lt;b&gt;<mark>gophers</mark>&lt;/b&gt; like pasta" {
+		t.Fatalf("on getting a wrongly highlighted snippet: %s", got)
+	}
+
+	inTitle.Title = "Nothing"
+	if err := stores.Posts.Update(context.TODO(), inTitle); err != nil {
+		t.Fatalf("on updating a post: %s", err.Error())
+	}
+	if result := search(t, stores, "gophers"); result.Total != 1 {
+		t.Fatalf("expected 1 hit after the update, instead we got: %d", result.Total)
+	}
+	if err := stores.Posts.DeleteByID(context.TODO(), inTitle.ID.Hex()); err != nil {
+		t.Fatalf("on deleting a post: %s", err.Error())
+	}
+	if result := search(t, stores, "nothing"); result.Total != 0 {
+		t.Fatalf("expected no hits after the deletion, instead we got: %d", result.Total)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	content := strings.Repeat("word ", 20) + "needle" + strings.Repeat(" word", 40)
+	got := snippet(content, queryTerms("needle"))
+	expected := "…" + strings.Repeat("word ", snippetBefore) + "<mark>needle</mark>" +
+		strings.Repeat(" word", snippetLen-snippetBefore-1) + "…"
+	if got != expected {
+		t.Fatalf("expected the snippet %q, instead we got: %q", expected, got)
+	}
+}
@@ -0,0 +1,80 @@
+package search
+
+import (
+	"context"
+
+	"github.com/meddion/web-blog/pkg/models"
+)
+
+// indexPageSize is the number of posts read at once while building an index
+const indexPageSize = 100
+
+// indexedPostStore keeps the index up to date with the posts it saves, updates & deletes
+type indexedPostStore struct {
+	models.PostStore
+	idx *Index
+}
+
+// Attach indexes every post of stores.Posts, wraps it to keep the index up to date
+// & sets stores.Search to query the index
+func Attach(ctx context.Context, stores *models.Stores) error {
+	idx := NewIndex()
+	for page := int64(1); ; page++ {
+		posts, err := stores.Posts.List(ctx, models.PostsQuery{PageSize: indexPageSize, PageNum: page})
+		if err != nil {
+			return err
+		}
+		for _, p := range posts {
+			idx.Add(&p.Post)
+		}
+		if len(posts) < indexPageSize {
+			break
+		}
+	}
+	stores.Posts = &indexedPostStore{stores.Posts, idx}
+	stores.Search = idx
+	return nil
+}
+
+func (s *indexedPostStore) Save(ctx context.Context, p *models.Post) error {
+	if err := s.PostStore.Save(ctx, p); err != nil {
+		return err
+	}
+	s.idx.Add(p)
+	return nil
+}
+
+func (s *indexedPostStore) Update(ctx context.Context, p *models.Post) error {
+	if err := s.PostStore.Update(ctx, p); err != nil {
+		return err
+	}
+	// p might miss the fields which weren't changed
+	return s.reindex(ctx, p.ID.Hex())
+}
+
+func (s *indexedPostStore) DeleteByID(ctx context.Context, id string) error {
+	if err := s.PostStore.DeleteByID(ctx, id); err != nil {
+		return err
+	}
+	s.idx.Remove(id)
+	return nil
+}
+
+func (s *indexedPostStore) PublishDue(ctx context.Context, now int64) ([]*models.Post, error) {
+	published, err := s.PostStore.PublishDue(ctx, now)
+	for _, p := range published {
+		if err := s.reindex(ctx, p.ID.Hex()); err != nil {
+			return published, err
+		}
+	}
+	return published, err
+}
+
+func (s *indexedPostStore) reindex(ctx context.Context, id string) error {
+	post, err := s.PostStore.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	s.idx.Add(post)
+	return nil
+}
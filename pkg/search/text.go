@@ -0,0 +1,115 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+const (
+	snippetBefore = 10 // words of a snippet preceding the first match
+	snippetLen    = 30 // words in a snippet
+)
+
+var stopWords = map[string]struct{}{
+	"a": {}, "an": {}, "and": {}, "are": {}, "as": {}, "at": {}, "be": {}, "by": {}, "for": {},
+	"from": {}, "in": {}, "is": {}, "it": {}, "of": {}, "on": {}, "or": {}, "that": {}, "the": {},
+	"this": {}, "to": {}, "was": {}, "with": {},
+}
+
+// token is a word of a text along with its byte offsets
+type token struct {
+	term       string
+	start, end int
+}
+
+// tokenize splits s into lowercase words of letters & digits
+func tokenize(s string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range s {
+		isWordRune := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWordRune && start < 0 {
+			start = i
+		}
+		if !isWordRune && start >= 0 {
+			tokens = append(tokens, token{strings.ToLower(s[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{strings.ToLower(s[start:]), start, len(s)})
+	}
+	return tokens
+}
+
+// queryTerms returns distinct terms of the query leaving out stop words
+func queryTerms(q string) map[string]struct{} {
+	terms := make(map[string]struct{})
+	for _, t := range tokenize(q) {
+		if _, ok := stopWords[t.term]; !ok {
+			terms[t.term] = struct{}{}
+		}
+	}
+	return terms
+}
+
+// highlight returns HTML-escaped s with the words among terms wrapped in <mark> tags
+func highlight(s string, terms map[string]struct{}) string {
+	return highlightTokens(s, tokenize(s), terms)
+}
+
+func highlightTokens(s string, tokens []token, terms map[string]struct{}) string {
+	var b strings.Builder
+	last := 0
+	for _, t := range tokens {
+		if _, ok := terms[t.term]; !ok {
+			continue
+		}
+		b.WriteString(html.EscapeString(s[last:t.start]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(s[t.start:t.end]))
+		b.WriteString("</mark>")
+		last = t.end
+	}
+	b.WriteString(html.EscapeString(s[last:]))
+	return b.String()
+}
+
+// snippet returns a highlighted piece of s around the first match of terms,
+// or the beginning of s if there are no matches
+func snippet(s string, terms map[string]struct{}) string {
+	tokens := tokenize(s)
+	if len(tokens) == 0 {
+		return ""
+	}
+	from := 0
+	for i, t := range tokens {
+		if _, ok := terms[t.term]; ok {
+			from = i - snippetBefore
+			break
+		}
+	}
+	if from < 0 {
+		from = 0
+	}
+	to := from + snippetLen
+	if to > len(tokens) {
+		to = len(tokens)
+	}
+
+	start, end := tokens[from].start, tokens[to-1].end
+	window := tokens[from:to]
+	shifted := make([]token, len(window))
+	for i, t := range window {
+		shifted[i] = token{t.term, t.start - start, t.end - start}
+	}
+	text := highlightTokens(s[start:end], shifted, terms)
+	if from > 0 {
+		text = "…" + text
+	}
+	if to < len(tokens) {
+		text += "…"
+	}
+	return text
+}
@@ -0,0 +1,31 @@
+package session
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+)
+
+// entry wraps a value, so gob keeps the name of its type
+type entry struct {
+	Value interface{}
+}
+
+// EncodeValue serializes a session value for providers which persist sessions,
+// its type (unless it's a basic one) has to be registered with gob.Register
+func EncodeValue(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&entry{Value: value}); err != nil {
+		return nil, fmt.Errorf("on encoding a session value: %s", err.Error())
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeValue restores a value serialized by EncodeValue
+func DecodeValue(b []byte) (interface{}, error) {
+	e := &entry{}
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(e); err != nil {
+		return nil, err
+	}
+	return e.Value, nil
+}
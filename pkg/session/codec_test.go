@@ -0,0 +1,36 @@
+package session
+
+import (
+	"encoding/gob"
+	"reflect"
+	"testing"
+)
+
+type user struct {
+	Name  string
+	Roles []string
+}
+
+func init() {
+	gob.Register(&user{})
+}
+
+func TestEncodeValue(t *testing.T) {
+	values := []interface{}{int64(42), 5, "text", &user{Name: "alice", Roles: []string{"admin"}}}
+	for _, v := range values {
+		b, err := EncodeValue(v)
+		if err != nil {
+			t.Fatalf("on encoding %v: %s", v, err.Error())
+		}
+		got, err := DecodeValue(b)
+		if err != nil {
+			t.Fatalf("on decoding %v: %s", v, err.Error())
+		}
+		if !reflect.DeepEqual(got, v) {
+			t.Fatalf("expected %#v to be decoded, instead we got: %#v", v, got)
+		}
+	}
+	if _, err := EncodeValue(struct{ A int }{1}); err == nil {
+		t.Fatal("expected a value of an unregistered type to be rejected")
+	}
+}
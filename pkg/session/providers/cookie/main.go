@@ -0,0 +1,206 @@
+// Package providers implements a stateless session provider: the data of a session is encrypted
+// & authenticated with AES-GCM into the session cookie itself, so nothing is kept on the server.
+// Several keys may be given to rotate them: the first one seals sessions, all of them are tried to open ones.
+// Values are encoded with session.EncodeValue
+package providers
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/session"
+)
+
+// maxCookieLen keeps cookies within the limit of browsers (4096 bytes along with the name & attributes)
+const maxCookieLen = 3800
+
+// additionalData binds sealed values to their purpose, so data sealed by the same keys elsewhere can't pass for a session
+var additionalData = []byte("web-blog session")
+
+type sealedData struct {
+	ID     string
+	Values map[string][]byte
+	Sealed int64 // unix time
+}
+
+type SessionStore struct {
+	id     string
+	values map[interface{}]interface{}
+}
+
+func (s *SessionStore) Set(key, value interface{}) error {
+	if _, ok := key.(string); !ok {
+		return fmt.Errorf("on using an invalid session key: %v", key)
+	}
+	s.values[key] = value
+	return nil
+}
+
+func (s *SessionStore) Get(key interface{}) interface{} {
+	return s.values[key]
+}
+
+func (s *SessionStore) Delete(key interface{}) error {
+	delete(s.values, key)
+	return nil
+}
+
+func (s *SessionStore) IsValuePresent(key interface{}) bool {
+	_, ok := s.values[key]
+	return ok
+}
+
+func (s *SessionStore) GetSessionID() string {
+	return s.id
+}
+
+func (s *SessionStore) Keys() []interface{} {
+	keys := make([]interface{}, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+type Provider struct {
+	aeads    []cipher.AEAD
+	lifetime time.Duration
+	clock    session.Clock
+}
+
+// New returns a provider sealing sessions with the first of keys (16, 24 or 32 bytes long for AES-128, 192 or 256),
+// sessions which haven't been changed for lifetime can't be opened anymore
+func New(keys [][]byte, lifetime time.Duration) (*Provider, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("on creating a cookie session provider without keys")
+	}
+	p := &Provider{lifetime: lifetime, clock: time.Now}
+	for _, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("on creating a cipher of a session key: %s", err.Error())
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		p.aeads = append(p.aeads, aead)
+	}
+	return p, nil
+}
+
+// SetClock replaces the clock telling the time sessions are sealed & opened at,
+// it has to be called before the provider is used
+func (p *Provider) SetClock(clock session.Clock) {
+	p.clock = clock
+}
+
+func (p *Provider) SessionInit(id string) (session.Session, error) {
+	return &SessionStore{id: id, values: make(map[interface{}]interface{})}, nil
+}
+
+// SessionRead opens the session sealed into value,
+// an error is returned if it was tampered with, sealed by an unknown key or has expired
+func (p *Provider) SessionRead(value string) (session.Session, error) {
+	data, err := p.open(value)
+	if err != nil {
+		return nil, err
+	}
+	if p.clock().Sub(time.Unix(data.Sealed, 0)) > p.lifetime {
+		return nil, errors.New("on opening an expired session")
+	}
+	s := &SessionStore{id: data.ID, values: make(map[interface{}]interface{}, len(data.Values))}
+	for key, b := range data.Values {
+		// Values which can't be decoded anymore (e.g. their types were changed) are left out
+		value, err := session.DecodeValue(b)
+		if err != nil {
+			log.Printf("on decoding the value of %q in a session: %s", key, err.Error())
+			continue
+		}
+		s.values[key] = value
+	}
+	return s, nil
+}
+
+// Seal returns the value of the cookie holding s encrypted by the newest key
+func (p *Provider) Seal(s session.Session) (string, error) {
+	store, ok := s.(*SessionStore)
+	if !ok {
+		return "", errors.New("on sealing a session of another provider")
+	}
+	data := &sealedData{ID: store.id, Values: make(map[string][]byte, len(store.values)), Sealed: p.clock().Unix()}
+	for key, value := range store.values {
+		b, err := session.EncodeValue(value)
+		if err != nil {
+			return "", err
+		}
+		data.Values[key.(string)] = b
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(data); err != nil {
+		return "", fmt.Errorf("on encoding a session: %s", err.Error())
+	}
+	aead := p.aeads[0]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, buf.Bytes(), additionalData))
+	if len(sealed) > maxCookieLen {
+		return "", errors.New("on sealing a session which is too large for a cookie")
+	}
+	return sealed, nil
+}
+
+func (p *Provider) open(value string) (*sealedData, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	for _, aead := range p.aeads {
+		if len(b) < aead.NonceSize() {
+			continue
+		}
+		plain, err := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], additionalData)
+		if err != nil {
+			continue
+		}
+		data := &sealedData{}
+		if err := gob.NewDecoder(bytes.NewReader(plain)).Decode(data); err != nil {
+			return nil, fmt.Errorf("on decoding a session: %s", err.Error())
+		}
+		return data, nil
+	}
+	return nil, errors.New("on opening a session which isn't sealed by any of the keys")
+}
+
+// Sessions live in cookies only, so there is nothing to update, destroy or collect.
+// Sessions can't be revoked before they expire, logging out just removes the cookie
+
+func (p *Provider) SessionUpdate(id string) error {
+	return nil
+}
+
+func (p *Provider) SessionDestroy(id string) error {
+	return nil
+}
+
+func (p *Provider) SessionGC(maxLifeTime int64) {}
+
+// SessionBind does nothing as sessions can't be looked up by users
+func (p *Provider) SessionBind(id, user string, device session.Device) error {
+	return nil
+}
+
+func (p *Provider) SessionsByUser(user string) ([]session.Info, error) {
+	return nil, session.ErrNotSupported
+}
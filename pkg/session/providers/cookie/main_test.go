@@ -0,0 +1,66 @@
+package providers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestSealAndOpen(t *testing.T) {
+	oldKey, newKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	old, err := New([][]byte{oldKey}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ := old.SessionInit("sid")
+	s.Set("AUTH_TIME", int64(42))
+	sealedByOld, err := old.Seal(s)
+	if err != nil {
+		t.Fatalf("on sealing a session: %s", err.Error())
+	}
+
+	// Rotating the keys: sessions sealed by the old key are still valid
+	rotated, err := New([][]byte{newKey, oldKey}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, err := rotated.SessionRead(sealedByOld)
+	if err != nil {
+		t.Fatalf("on opening a session sealed by an old key: %s", err.Error())
+	}
+	if opened.GetSessionID() != "sid" || opened.Get("AUTH_TIME") != int64(42) {
+		t.Fatalf("got an unexpected session: %#v", opened)
+	}
+	sealedByNew, err := rotated.Seal(opened)
+	if err != nil {
+		t.Fatalf("on sealing a session: %s", err.Error())
+	}
+	if _, err := old.SessionRead(sealedByNew); err == nil {
+		t.Fatal("expected a session sealed by an unknown key to be rejected")
+	}
+
+	// Flipping a bit of the ciphertext
+	b, _ := base64.RawURLEncoding.DecodeString(sealedByNew)
+	b[len(b)/2] ^= 1
+	tampered := base64.RawURLEncoding.EncodeToString(b)
+	if _, err := rotated.SessionRead(tampered); err == nil {
+		t.Fatal("expected a tampered session to be rejected")
+	}
+
+	now := time.Now()
+	expiring, _ := New([][]byte{newKey}, time.Hour)
+	expiring.SetClock(func() time.Time { return now })
+	sealed, err := expiring.Seal(s)
+	if err != nil {
+		t.Fatalf("on sealing a session: %s", err.Error())
+	}
+	now = now.Add(59 * time.Minute)
+	if _, err := expiring.SessionRead(sealed); err != nil {
+		t.Fatalf("expected a session sealed within the lifetime to be opened, instead we got: %s", err.Error())
+	}
+	now = now.Add(2 * time.Minute)
+	if _, err := expiring.SessionRead(sealed); err == nil {
+		t.Fatal("expected an expired session to be rejected")
+	}
+}
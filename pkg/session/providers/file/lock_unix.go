@@ -0,0 +1,44 @@
+//go:build !windows
+// +build !windows
+
+package providers
+
+import (
+	"os"
+	"sync"
+	"syscall"
+)
+
+// fileLock serializes access to the sessions between goroutines & processes,
+// the latter by flock(2) on a lock file
+type fileLock struct {
+	mu   sync.RWMutex
+	path string
+}
+
+func newFileLock(path string) *fileLock {
+	return &fileLock{path: path}
+}
+
+// do runs fn holding the lock, exclusive one if it's true
+func (l *fileLock) do(exclusive bool, fn func() error) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+		l.mu.Lock()
+		defer l.mu.Unlock()
+	} else {
+		l.mu.RLock()
+		defer l.mu.RUnlock()
+	}
+	f, err := os.OpenFile(l.path, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	return fn()
+}
@@ -0,0 +1,25 @@
+package providers
+
+import "sync"
+
+// fileLock serializes access to the sessions between goroutines only,
+// so the directory mustn't be shared by several processes on Windows
+type fileLock struct {
+	mu sync.RWMutex
+}
+
+func newFileLock(path string) *fileLock {
+	return &fileLock{}
+}
+
+// do runs fn holding the lock, exclusive one if it's true
+func (l *fileLock) do(exclusive bool, fn func() error) error {
+	if exclusive {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+	} else {
+		l.mu.RLock()
+		defer l.mu.RUnlock()
+	}
+	return fn()
+}
@@ -0,0 +1,281 @@
+// Package providers implements a session provider which keeps every session in a file of a directory,
+// so sessions survive restarts of a single-host deployment. Files are replaced atomically
+// & access to them is serialized by a lock file, so several processes may share the directory.
+// Values are encoded with session.EncodeValue
+package providers
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/session"
+)
+
+const (
+	lockName   = ".lock"
+	fileExt    = ".session"
+	tempPrefix = ".tmp-"
+)
+
+type fileData struct {
+	ID     string
+	Values map[string][]byte
+	// Set once the session is bound to a user
+	User   string
+	Device session.Device
+	Bound  time.Time
+}
+
+type SessionStore struct {
+	id       string
+	values   map[interface{}]interface{}
+	provider *Provider
+}
+
+func (s *SessionStore) Set(key, value interface{}) error {
+	name, ok := key.(string)
+	if !ok {
+		return fmt.Errorf("on using an invalid session key: %v", key)
+	}
+	b, err := session.EncodeValue(value)
+	if err != nil {
+		return err
+	}
+	if err := s.provider.modify(s.id, func(d *fileData) { d.Values[name] = b }); err != nil {
+		return err
+	}
+	s.values[key] = value
+	return nil
+}
+
+func (s *SessionStore) Get(key interface{}) interface{} {
+	return s.values[key]
+}
+
+func (s *SessionStore) Delete(key interface{}) error {
+	name, ok := key.(string)
+	if !ok {
+		return fmt.Errorf("on using an invalid session key: %v", key)
+	}
+	if err := s.provider.modify(s.id, func(d *fileData) { delete(d.Values, name) }); err != nil {
+		return err
+	}
+	delete(s.values, key)
+	return nil
+}
+
+func (s *SessionStore) IsValuePresent(key interface{}) bool {
+	_, ok := s.values[key]
+	return ok
+}
+
+func (s *SessionStore) GetSessionID() string {
+	return s.id
+}
+
+func (s *SessionStore) Keys() []interface{} {
+	keys := make([]interface{}, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+type Provider struct {
+	dir      string
+	lifetime time.Duration
+	lock     *fileLock
+}
+
+// New returns a provider keeping sessions in dir (which is created if it's missing),
+// sessions which haven't been accessed for lifetime are considered expired
+func New(dir string, lifetime time.Duration) (*Provider, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("on creating the directory of sessions: %s", err.Error())
+	}
+	return &Provider{dir: dir, lifetime: lifetime, lock: newFileLock(filepath.Join(dir, lockName))}, nil
+}
+
+func (p *Provider) SessionInit(id string) (session.Session, error) {
+	err := p.lock.do(true, func() error {
+		return p.write(id, &fileData{ID: id, Values: map[string][]byte{}})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &SessionStore{id: id, values: make(map[interface{}]interface{}), provider: p}, nil
+}
+
+// SessionRead returns the session with id marking it as accessed,
+// an error is returned if there is no such session or it has expired
+func (p *Provider) SessionRead(id string) (session.Session, error) {
+	var d *fileData
+	err := p.lock.do(false, func() error {
+		var err error
+		if d, err = p.read(id); err != nil {
+			return err
+		}
+		now := time.Now()
+		return os.Chtimes(p.path(id), now, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s := &SessionStore{id: id, values: make(map[interface{}]interface{}, len(d.Values)), provider: p}
+	for key, b := range d.Values {
+		// Values which can't be decoded anymore (e.g. their types were changed) are left out
+		value, err := session.DecodeValue(b)
+		if err != nil {
+			log.Printf("on decoding the value of %q in a session: %s", key, err.Error())
+			continue
+		}
+		s.values[key] = value
+	}
+	return s, nil
+}
+
+func (p *Provider) SessionDestroy(id string) error {
+	return p.lock.do(true, func() error {
+		if err := os.Remove(p.path(id)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+func (p *Provider) SessionUpdate(id string) error {
+	return p.lock.do(false, func() error {
+		now := time.Now()
+		return os.Chtimes(p.path(id), now, now)
+	})
+}
+
+// SessionGC removes files of the sessions which haven't been accessed for maxLifeTime (in seconds)
+// along with temporary files left by interrupted writes
+func (p *Provider) SessionGC(maxLifeTime int64) {
+	err := p.lock.do(true, func() error {
+		infos, err := ioutil.ReadDir(p.dir)
+		if err != nil {
+			return err
+		}
+		expired := time.Now().Add(-time.Duration(maxLifeTime) * time.Second)
+		for _, info := range infos {
+			name := info.Name()
+			ours := strings.HasSuffix(name, fileExt) || strings.HasPrefix(name, tempPrefix)
+			if ours && !info.IsDir() && info.ModTime().Before(expired) {
+				if err := os.Remove(filepath.Join(p.dir, name)); err != nil && !os.IsNotExist(err) {
+					log.Printf("on removing an expired session: %s", err.Error())
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("on removing expired sessions: %s", err.Error())
+	}
+}
+
+func (p *Provider) SessionBind(id, user string, device session.Device) error {
+	return p.modify(id, func(d *fileData) {
+		d.User, d.Device, d.Bound = user, device, time.Now()
+	})
+}
+
+// SessionsByUser reads every session, which is fine for the number of sessions of a single host
+func (p *Provider) SessionsByUser(user string) ([]session.Info, error) {
+	infos := make([]session.Info, 0)
+	err := p.lock.do(false, func() error {
+		names, err := filepath.Glob(filepath.Join(p.dir, "*"+fileExt))
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			d, info, err := p.readFile(name)
+			if err != nil {
+				continue // expired or removed meanwhile
+			}
+			if d.User == user && d.ID != "" {
+				infos = append(infos, session.Info{ID: d.ID, Device: d.Device, Created: d.Bound, LastSeen: info.ModTime()})
+			}
+		}
+		return nil
+	})
+	return infos, err
+}
+
+// modify changes the data of the session with id holding the lock
+func (p *Provider) modify(id string, fn func(d *fileData)) error {
+	return p.lock.do(true, func() error {
+		d, err := p.read(id)
+		if err != nil {
+			return err
+		}
+		fn(d)
+		return p.write(id, d)
+	})
+}
+
+func (p *Provider) read(id string) (*fileData, error) {
+	d, _, err := p.readFile(p.path(id))
+	return d, err
+}
+
+func (p *Provider) readFile(path string) (*fileData, os.FileInfo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if time.Since(info.ModTime()) > p.lifetime {
+		return nil, nil, fmt.Errorf("on reading an expired session")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	d := &fileData{}
+	if err := gob.NewDecoder(f).Decode(d); err != nil {
+		return nil, nil, fmt.Errorf("on decoding a session file: %s", err.Error())
+	}
+	if d.Values == nil {
+		d.Values = make(map[string][]byte)
+	}
+	return d, info, nil
+}
+
+// write replaces the file of the session with id atomically: it writes a temporary file
+// & renames it, so readers see either the old or the new version
+func (p *Provider) write(id string, d *fileData) error {
+	f, err := ioutil.TempFile(p.dir, tempPrefix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := gob.NewEncoder(f).Encode(d); err != nil {
+		f.Close()
+		return fmt.Errorf("on encoding a session file: %s", err.Error())
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p.path(id))
+}
+
+// path returns the file of the session with id, IDs come from cookies,
+// so they are hashed to keep the files within the directory
+func (p *Provider) path(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(p.dir, hex.EncodeToString(sum[:])+fileExt)
+}
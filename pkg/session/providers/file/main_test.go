@@ -0,0 +1,101 @@
+package providers
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/session"
+)
+
+func newProvider(t *testing.T) *Provider {
+	dir, err := ioutil.TempDir("", "sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	p, err := New(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestSessionPersistence(t *testing.T) {
+	p := newProvider(t)
+	s, err := p.SessionInit("sid")
+	if err != nil {
+		t.Fatalf("on initializing a session: %s", err.Error())
+	}
+	if err := s.Set("AUTH_TIME", int64(42)); err != nil {
+		t.Fatalf("on setting a value: %s", err.Error())
+	}
+	s.Set("PENDING", "code")
+	s.Delete("PENDING")
+
+	// Reading the session anew, as another process would do
+	read, err := p.SessionRead("sid")
+	if err != nil {
+		t.Fatalf("on reading the session: %s", err.Error())
+	}
+	if v := read.Get("AUTH_TIME"); v != int64(42) {
+		t.Fatalf("expected the value to be 42, instead we got: %#v", v)
+	}
+	if read.IsValuePresent("PENDING") {
+		t.Fatal("expected a deleted value to be gone")
+	}
+	if _, err := p.SessionRead("unknown"); err == nil {
+		t.Fatal("expected an unknown session not to be read")
+	}
+
+	if err := p.SessionDestroy("sid"); err != nil {
+		t.Fatalf("on destroying the session: %s", err.Error())
+	}
+	if _, err := p.SessionRead("sid"); err == nil {
+		t.Fatal("expected a destroyed session not to be read")
+	}
+}
+
+func TestSessionGC(t *testing.T) {
+	p := newProvider(t)
+	p.SessionInit("old")
+	p.SessionInit("new")
+	past := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(p.path("old"), past, past)
+
+	if _, err := p.SessionRead("old"); err == nil {
+		t.Fatal("expected an expired session not to be read")
+	}
+	p.SessionGC(int64(time.Hour.Seconds()))
+	if _, err := os.Stat(p.path("old")); !os.IsNotExist(err) {
+		t.Fatalf("expected the file of an expired session to be removed, instead we got: %v", err)
+	}
+	if _, err := p.SessionRead("new"); err != nil {
+		t.Fatalf("expected an active session to be kept, instead we got: %v", err)
+	}
+}
+
+func TestSessionsByUser(t *testing.T) {
+	p := newProvider(t)
+	p.SessionInit("phone")
+	p.SessionInit("laptop")
+	p.SessionInit("anonymous")
+	device := session.Device{UserAgent: "Mozilla/5.0", IP: "10.0.0.1"}
+	if err := p.SessionBind("phone", "user", device); err != nil {
+		t.Fatalf("on binding the session: %s", err.Error())
+	}
+	p.SessionBind("laptop", "user", session.Device{})
+	p.SessionBind("laptop", "other", session.Device{})
+
+	infos, err := p.SessionsByUser("user")
+	if err != nil {
+		t.Fatalf("on listing the sessions: %s", err.Error())
+	}
+	if len(infos) != 1 || infos[0].ID != "phone" || infos[0].Device != device {
+		t.Fatalf("expected only the phone session to be listed, instead we got: %#v", infos)
+	}
+	if infos[0].Created.IsZero() || infos[0].LastSeen.IsZero() {
+		t.Fatalf("expected the times of the session to be set, instead we got: %#v", infos[0])
+	}
+}
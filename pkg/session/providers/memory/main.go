@@ -2,35 +2,38 @@ package providers
 
 import (
 	"container/list"
+	"errors"
 	"sync"
 	"time"
 
 	"github.com/meddion/web-blog/pkg/session"
 )
 
-var provider = &Provider{
-	sessions: make(map[string]*list.Element, 0),
-	list:     list.New(),
-}
-
-func init() {
-	session.Register("memory", provider)
-}
-
 type SessionStore struct {
 	id           string
-	timeAccessed time.Time
-	value        map[interface{}]interface{}
+	provider     *Provider
+	timeAccessed time.Time // guarded by the lock of the provider
+	// Set once the session is bound to a user, guarded by the lock of the provider
+	user      string
+	device    session.Device
+	timeBound time.Time
+	// The values are guarded by the lock of the session, requests can use it at the same time
+	value map[interface{}]interface{}
+	sync.Mutex
 }
 
 func (s *SessionStore) Set(key, value interface{}) error {
-	provider.SessionUpdate(s.id)
+	s.provider.SessionUpdate(s.id)
+	s.Lock()
+	defer s.Unlock()
 	s.value[key] = value
 	return nil
 }
 
 func (s *SessionStore) Get(key interface{}) interface{} {
-	provider.SessionUpdate(s.id)
+	s.provider.SessionUpdate(s.id)
+	s.Lock()
+	defer s.Unlock()
 	if v, ok := s.value[key]; ok {
 		return v
 	}
@@ -38,52 +41,98 @@ func (s *SessionStore) Get(key interface{}) interface{} {
 }
 
 func (s *SessionStore) Delete(key interface{}) error {
-	provider.SessionUpdate(s.id)
+	s.provider.SessionUpdate(s.id)
+	s.Lock()
+	defer s.Unlock()
 	delete(s.value, key)
 	return nil
 }
 
 func (s *SessionStore) IsValuePresent(key interface{}) bool {
-	provider.SessionUpdate(s.id)
+	s.provider.SessionUpdate(s.id)
+	s.Lock()
+	defer s.Unlock()
 	_, ok := s.value[key]
 	return ok
 }
 
 func (s *SessionStore) GetSessionID() string {
-	provider.SessionUpdate(s.id)
+	s.provider.SessionUpdate(s.id)
 	return s.id
 }
 
+func (s *SessionStore) Keys() []interface{} {
+	s.provider.SessionUpdate(s.id)
+	s.Lock()
+	defer s.Unlock()
+	keys := make([]interface{}, 0, len(s.value))
+	for key := range s.value {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Provider keeps sessions in memory, the least recently accessed ones at the back of the list
 type Provider struct {
 	sessions map[string]*list.Element
 	list     *list.List
+	byUser   map[string]map[string]struct{} // user -> IDs of the sessions bound to it
+	idle     time.Duration
+	clock    session.Clock
 	sync.Mutex
 }
 
+// New returns a provider of sessions which expire after being idle for idle
+func New(idle time.Duration) *Provider {
+	return &Provider{
+		sessions: make(map[string]*list.Element),
+		list:     list.New(),
+		byUser:   make(map[string]map[string]struct{}),
+		idle:     idle,
+		clock:    time.Now,
+	}
+}
+
+// SetClock replaces the clock telling the time sessions are accessed at,
+// it has to be called before the provider is used
+func (p *Provider) SetClock(clock session.Clock) {
+	p.clock = clock
+}
+
 func (p *Provider) SessionInit(id string) (session.Session, error) {
 	p.Lock()
 	defer p.Unlock()
 	newSession := &SessionStore{
 		id:           id,
-		timeAccessed: time.Now(),
+		provider:     p,
+		timeAccessed: p.clock(),
 		value:        make(map[interface{}]interface{}, 0),
 	}
 	p.sessions[id] = p.list.PushFront(newSession)
 	return newSession, nil
 }
 
+// SessionRead returns the session with id, an error is returned if there is no such session
+// (so clients can't choose IDs of their sessions) or it has been idle for too long
 func (p *Provider) SessionRead(id string) (session.Session, error) {
-	if element, ok := p.sessions[id]; ok {
-		return element.Value.(*SessionStore), nil
+	p.Lock()
+	defer p.Unlock()
+	element, ok := p.sessions[id]
+	if !ok {
+		return nil, errors.New("on reading an unknown session")
+	}
+	if p.expired(element, p.idle) {
+		p.remove(element)
+		return nil, errors.New("on reading an expired session")
 	}
-	newSession, err := p.SessionInit(id)
-	return newSession, err
+	return element.Value.(*SessionStore), nil
 }
 
 func (p *Provider) SessionDestroy(id string) error {
+	p.Lock()
+	defer p.Unlock()
 	if element, ok := p.sessions[id]; ok {
-		delete(p.sessions, id)
-		p.list.Remove(element)
+		p.remove(element)
 	}
 	return nil
 }
@@ -92,23 +141,71 @@ func (p *Provider) SessionUpdate(id string) error {
 	p.Lock()
 	defer p.Unlock()
 	if element, ok := p.sessions[id]; ok {
-		element.Value.(*SessionStore).timeAccessed = time.Now()
+		element.Value.(*SessionStore).timeAccessed = p.clock()
 		p.list.MoveToFront(element)
 		return nil
 	}
 	return nil
 }
 
+// SessionGC removes the sessions which haven't been accessed for maxLifeTime (in seconds)
 func (p *Provider) SessionGC(maxLifeTime int64) {
 	p.Lock()
 	defer p.Unlock()
-	for {
-		element := p.list.Back()
-		if element == nil ||
-			element.Value.(*SessionStore).timeAccessed.Unix() < time.Now().Unix()+maxLifeTime {
-			break
-		}
-		p.list.Remove(element)
-		delete(p.sessions, element.Value.(*SessionStore).id)
+	maxIdle := time.Duration(maxLifeTime) * time.Second
+	// The least recently accessed sessions are at the back
+	for element := p.list.Back(); element != nil && p.expired(element, maxIdle); element = p.list.Back() {
+		p.remove(element)
+	}
+}
+
+func (p *Provider) SessionBind(id, user string, device session.Device) error {
+	p.Lock()
+	defer p.Unlock()
+	element, ok := p.sessions[id]
+	if !ok {
+		return errors.New("on binding an unknown session")
+	}
+	s := element.Value.(*SessionStore)
+	p.unbind(s)
+	s.user, s.device, s.timeBound = user, device, p.clock()
+	if p.byUser[user] == nil {
+		p.byUser[user] = make(map[string]struct{})
+	}
+	p.byUser[user][id] = struct{}{}
+	return nil
+}
+
+func (p *Provider) SessionsByUser(user string) ([]session.Info, error) {
+	p.Lock()
+	defer p.Unlock()
+	infos := make([]session.Info, 0, len(p.byUser[user]))
+	for id := range p.byUser[user] {
+		s := p.sessions[id].Value.(*SessionStore)
+		infos = append(infos, session.Info{ID: id, Device: s.device, Created: s.timeBound, LastSeen: s.timeAccessed})
+	}
+	return infos, nil
+}
+
+// expired tells if the session of element has been idle for longer than idle, the lock has to be held
+func (p *Provider) expired(element *list.Element, idle time.Duration) bool {
+	return p.clock().Sub(element.Value.(*SessionStore).timeAccessed) > idle
+}
+
+// remove drops the session of element, the lock has to be held
+func (p *Provider) remove(element *list.Element) {
+	s := element.Value.(*SessionStore)
+	p.unbind(s)
+	p.list.Remove(element)
+	delete(p.sessions, s.id)
+}
+
+func (p *Provider) unbind(s *SessionStore) {
+	if s.user == "" {
+		return
+	}
+	delete(p.byUser[s.user], s.id)
+	if len(p.byUser[s.user]) == 0 {
+		delete(p.byUser, s.user)
 	}
 }
@@ -0,0 +1,55 @@
+package providers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/session"
+)
+
+func newProvider(now *time.Time) *Provider {
+	p := New(30 * time.Minute)
+	p.SetClock(func() time.Time { return *now })
+	return p
+}
+
+func TestSessionExpiry(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	p := newProvider(&now)
+	s, _ := p.SessionInit("sid")
+	s.Set("USER", "alice")
+
+	now = now.Add(20 * time.Minute)
+	if _, err := p.SessionRead("sid"); err != nil {
+		t.Fatalf("expected an active session to be read, instead we got: %s", err.Error())
+	}
+	now = now.Add(31 * time.Minute)
+	if _, err := p.SessionRead("sid"); err == nil {
+		t.Fatal("expected an idle session not to be read")
+	}
+	if _, err := p.SessionRead("unknown"); err == nil {
+		t.Fatal("expected an unknown session not to be read")
+	}
+}
+
+func TestSessionGC(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	p := newProvider(&now)
+	p.SessionInit("old")
+	p.SessionBind("old", "alice", session.Device{})
+	now = now.Add(time.Hour)
+	p.SessionInit("new")
+	p.SessionBind("new", "alice", session.Device{})
+
+	p.SessionGC(int64((30 * time.Minute).Seconds()))
+	if _, ok := p.sessions["old"]; ok {
+		t.Fatal("expected an idle session to be collected")
+	}
+	if _, ok := p.sessions["new"]; !ok {
+		t.Fatal("expected an active session to be kept")
+	}
+	infos, _ := p.SessionsByUser("alice")
+	if len(infos) != 1 || infos[0].ID != "new" {
+		t.Fatalf("expected a collected session to be unbound, instead we got: %#v", infos)
+	}
+}
@@ -0,0 +1,264 @@
+// Package providers implements a session provider which keeps sessions in a MongoDB collection,
+// so they survive restarts & are shared by every instance of the application.
+// Values are encoded with session.EncodeValue
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/session"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	opTimeout    = 3 * time.Second
+	ttlIndexName = "accessed_ttl"
+	// MongoDB codes of creating an index which exists with other options
+	codeIndexOptionsConflict  = 85
+	codeIndexKeySpecsConflict = 86
+)
+
+type document struct {
+	ID       string            `bson:"_id"`
+	Values   map[string][]byte `bson:"values"`
+	Accessed time.Time         `bson:"accessed"`
+	// Set once the session is bound to a user
+	User      string    `bson:"user,omitempty"`
+	UserAgent string    `bson:"user_agent,omitempty"`
+	IP        string    `bson:"ip,omitempty"`
+	Bound     time.Time `bson:"bound,omitempty"`
+}
+
+type SessionStore struct {
+	id       string
+	values   map[string]interface{}
+	provider *Provider
+}
+
+func (s *SessionStore) Set(key, value interface{}) error {
+	field, err := valueField(key)
+	if err != nil {
+		return err
+	}
+	b, err := session.EncodeValue(value)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	update := bson.M{"$set": bson.M{field: b, "accessed": time.Now()}}
+	result, err := s.provider.coll.UpdateOne(ctx, bson.M{"_id": s.id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("on setting a value of an unknown session")
+	}
+	s.values[key.(string)] = value
+	return nil
+}
+
+func (s *SessionStore) Get(key interface{}) interface{} {
+	name, _ := key.(string)
+	return s.values[name]
+}
+
+func (s *SessionStore) Delete(key interface{}) error {
+	field, err := valueField(key)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	update := bson.M{"$unset": bson.M{field: ""}, "$set": bson.M{"accessed": time.Now()}}
+	result, err := s.provider.coll.UpdateOne(ctx, bson.M{"_id": s.id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("on deleting a value of an unknown session")
+	}
+	delete(s.values, key.(string))
+	return nil
+}
+
+func (s *SessionStore) IsValuePresent(key interface{}) bool {
+	name, _ := key.(string)
+	_, ok := s.values[name]
+	return ok
+}
+
+func (s *SessionStore) GetSessionID() string {
+	return s.id
+}
+
+func (s *SessionStore) Keys() []interface{} {
+	keys := make([]interface{}, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+type Provider struct {
+	coll     *mongo.Collection
+	lifetime time.Duration
+}
+
+// New returns a provider keeping sessions in coll, sessions which haven't been accessed for lifetime
+// can't be read anymore & MongoDB removes them by itself
+func New(coll *mongo.Collection, lifetime time.Duration) (*Provider, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	index := ttlIndex(lifetime)
+	_, err := coll.Indexes().CreateOne(ctx, index)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && (cmdErr.Code == codeIndexOptionsConflict || cmdErr.Code == codeIndexKeySpecsConflict) {
+		// The lifetime has been changed since the index was made
+		if _, err = coll.Indexes().DropOne(ctx, ttlIndexName); err == nil {
+			_, err = coll.Indexes().CreateOne(ctx, index)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("on creating the TTL index of sessions: %s", err.Error())
+	}
+	if _, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.M{"user": 1}}); err != nil {
+		return nil, fmt.Errorf("on creating the user index of sessions: %s", err.Error())
+	}
+	return &Provider{coll: coll, lifetime: lifetime}, nil
+}
+
+// ttlIndex returns the index MongoDB removes sessions which haven't been accessed for lifetime by
+func ttlIndex(lifetime time.Duration) mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys:    bson.M{"accessed": 1},
+		Options: options.Index().SetName(ttlIndexName).SetExpireAfterSeconds(int32(lifetime.Seconds())),
+	}
+}
+
+func (p *Provider) SessionInit(id string) (session.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	doc := &document{ID: id, Values: map[string][]byte{}, Accessed: time.Now()}
+	if _, err := p.coll.InsertOne(ctx, doc); err != nil {
+		return nil, err
+	}
+	return &SessionStore{id: id, values: make(map[string]interface{}), provider: p}, nil
+}
+
+// SessionRead returns the session with id marking it as accessed, an error is returned
+// if there is no such session or it has expired (the TTL monitor removes sessions with a delay)
+func (p *Provider) SessionRead(id string) (session.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	now := time.Now()
+	filter := p.activeFilter(id, now)
+	doc := &document{}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := p.coll.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"accessed": now}}, opts).Decode(doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, errors.New("on reading an unknown or expired session")
+	} else if err != nil {
+		return nil, err
+	}
+	s := &SessionStore{id: id, values: make(map[string]interface{}, len(doc.Values)), provider: p}
+	for key, b := range doc.Values {
+		// Values which can't be decoded anymore (e.g. their types were changed) are left out
+		value, err := session.DecodeValue(b)
+		if err != nil {
+			log.Printf("on decoding the value of %q in a session: %s", key, err.Error())
+			continue
+		}
+		s.values[key] = value
+	}
+	return s, nil
+}
+
+// activeFilter matches the session with id unless it has been idle for the lifetime at now
+func (p *Provider) activeFilter(id string, now time.Time) bson.M {
+	return bson.M{"_id": id, "accessed": bson.M{"$gt": now.Add(-p.lifetime)}}
+}
+
+func (p *Provider) SessionDestroy(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	_, err := p.coll.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (p *Provider) SessionUpdate(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	result, err := p.coll.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"accessed": time.Now()}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("on updating an unknown session")
+	}
+	return nil
+}
+
+// SessionGC removes expired sessions, the TTL index does it as well but only once a minute
+func (p *Provider) SessionGC(maxLifeTime int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	expired := time.Now().Add(-time.Duration(maxLifeTime) * time.Second)
+	if _, err := p.coll.DeleteMany(ctx, bson.M{"accessed": bson.M{"$lt": expired}}); err != nil {
+		log.Printf("on removing expired sessions: %s", err.Error())
+	}
+}
+
+func (p *Provider) SessionBind(id, user string, device session.Device) error {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	update := bson.M{"$set": bson.M{"user": user, "user_agent": device.UserAgent, "ip": device.IP, "bound": time.Now()}}
+	result, err := p.coll.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("on binding an unknown session")
+	}
+	return nil
+}
+
+func (p *Provider) SessionsByUser(user string) ([]session.Info, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	cur, err := p.coll.Find(ctx, bson.M{"user": user}, options.Find().SetProjection(bson.M{"values": 0}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []*document
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	infos := make([]session.Info, 0, len(docs))
+	for _, doc := range docs {
+		infos = append(infos, session.Info{
+			ID:       doc.ID,
+			Device:   session.Device{UserAgent: doc.UserAgent, IP: doc.IP},
+			Created:  doc.Bound,
+			LastSeen: doc.Accessed,
+		})
+	}
+	return infos, nil
+}
+
+// valueField returns the path of the value with key in a document,
+// keys are limited to strings which are valid names of fields
+func valueField(key interface{}) (string, error) {
+	name, ok := key.(string)
+	if !ok || name == "" || strings.ContainsAny(name, ".$") {
+		return "", fmt.Errorf("on using an invalid session key: %v", key)
+	}
+	return "values." + name, nil
+}
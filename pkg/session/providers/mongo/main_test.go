@@ -0,0 +1,156 @@
+package providers
+
+import (
+	"context"
+	"encoding/gob"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/models"
+	"github.com/meddion/web-blog/pkg/session"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func init() {
+	gob.Register(&models.User{})
+}
+
+func TestValueField(t *testing.T) {
+	for _, key := range []interface{}{"", "a.b", "$where", 1} {
+		if _, err := valueField(key); err == nil {
+			t.Fatalf("expected key %#v to be rejected", key)
+		}
+	}
+	if field, err := valueField("USER"); err != nil || field != "values.USER" {
+		t.Fatalf("expected the field of USER to be values.USER, instead we got: %q, %v", field, err)
+	}
+}
+
+func TestDocumentValues(t *testing.T) {
+	user := &models.User{
+		ID: primitive.NewObjectID(), Name: "alice", Role: models.RoleEditor,
+		SessionsValidFrom: 42, TOTP: &models.TOTP{Secret: "secret"},
+	}
+	b, err := session.EncodeValue(user)
+	if err != nil {
+		t.Fatalf("on encoding a user: %s", err.Error())
+	}
+	raw, err := bson.Marshal(&document{ID: "sid", Values: map[string][]byte{"USER": b}})
+	if err != nil {
+		t.Fatalf("on marshaling a session: %s", err.Error())
+	}
+	doc := &document{}
+	if err := bson.Unmarshal(raw, doc); err != nil {
+		t.Fatalf("on unmarshaling a session: %s", err.Error())
+	}
+	got, err := session.DecodeValue(doc.Values["USER"])
+	if err != nil {
+		t.Fatalf("on decoding a user: %s", err.Error())
+	}
+	if !reflect.DeepEqual(got, user) {
+		t.Fatalf("expected %#v to be decoded, instead we got: %#v", user, got)
+	}
+}
+
+func TestActiveFilter(t *testing.T) {
+	p := &Provider{lifetime: 30 * time.Minute}
+	now := time.Unix(1600000000, 0)
+	filter := p.activeFilter("sid", now)
+	if filter["_id"] != "sid" {
+		t.Fatalf("expected the filter to match the session by its ID, instead we got: %v", filter)
+	}
+	if got := filter["accessed"].(bson.M)["$gt"]; got != now.Add(-30*time.Minute) {
+		t.Fatalf("expected sessions idle for 30 minutes to be filtered out, instead we got: %v", filter)
+	}
+}
+
+func TestTTLIndex(t *testing.T) {
+	index := ttlIndex(90 * time.Minute)
+	if !reflect.DeepEqual(index.Keys, bson.M{"accessed": 1}) {
+		t.Fatalf("expected the index to be on the access time, instead we got: %v", index.Keys)
+	}
+	if *index.Options.Name != ttlIndexName || *index.Options.ExpireAfterSeconds != 5400 {
+		t.Fatalf("expected index %q to expire sessions after 5400 seconds, instead we got: %q, %d",
+			ttlIndexName, *index.Options.Name, *index.Options.ExpireAfterSeconds)
+	}
+}
+
+// TestProvider runs against MongoDB from DB_URI & DB_NAME env variables, it's skipped when those aren't set
+func TestProvider(t *testing.T) {
+	uri, name := os.Getenv("DB_URI"), os.Getenv("DB_NAME")
+	if uri == "" || name == "" {
+		t.Skip("DB_URI and DB_NAME are required to run tests against MongoDB")
+	}
+	db, err := models.ConnectMongo(uri, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coll := db.Collection("sessions_test")
+	defer coll.Drop(context.TODO())
+	p, err := New(coll, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Changing the lifetime replaces the TTL index
+	if p, err = New(coll, 2*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	cur, err := coll.Indexes().List(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var indexes []bson.M
+	if err := cur.All(context.TODO(), &indexes); err != nil {
+		t.Fatal(err)
+	}
+	var expireAfter interface{}
+	for _, index := range indexes {
+		if index["name"] == ttlIndexName {
+			expireAfter = index["expireAfterSeconds"]
+		}
+	}
+	if expireAfter != int32(7200) {
+		t.Fatalf("expected the TTL index to expire sessions after 7200 seconds, instead we got: %v", expireAfter)
+	}
+
+	s, err := p.SessionInit("sid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{ID: primitive.NewObjectID(), Name: "alice"}
+	if err := s.Set("USER", user); err != nil {
+		t.Fatalf("on setting a value: %s", err.Error())
+	}
+	read, err := p.SessionRead("sid")
+	if err != nil {
+		t.Fatalf("on reading the session: %s", err.Error())
+	}
+	if got := read.Get("USER"); !reflect.DeepEqual(got, user) {
+		t.Fatalf("expected %#v to be read, instead we got: %#v", user, got)
+	}
+
+	// The session goes idle for longer than the lifetime
+	idle := bson.M{"$set": bson.M{"accessed": time.Now().Add(-3 * time.Hour)}}
+	if _, err := coll.UpdateOne(context.TODO(), bson.M{"_id": "sid"}, idle); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.SessionRead("sid"); err == nil {
+		t.Fatal("expected an idle session not to be read")
+	}
+
+	if err := p.SessionDestroy("sid"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("USER", user); err == nil {
+		t.Fatal("expected setting a value of a destroyed session to fail")
+	}
+	if err := s.Delete("USER"); err == nil {
+		t.Fatal("expected deleting a value of a destroyed session to fail")
+	}
+	if err := p.SessionUpdate("sid"); err == nil {
+		t.Fatal("expected updating a destroyed session to fail")
+	}
+}
@@ -1,14 +1,18 @@
 package session
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
-	"sync"
+	"strings"
 	"time"
 )
 
@@ -21,6 +25,8 @@ type Session interface {
 	Delete(key interface{}) error
 	IsValuePresent(ket interface{}) bool
 	GetSessionID() string
+	// Keys returns the keys of all the values in the session
+	Keys() []interface{}
 }
 
 // Provider is an interface which represents the underlying structure for our Session
@@ -30,6 +36,48 @@ type Provider interface {
 	SessionUpdate(sid string) error
 	SessionDestroy(sid string) error
 	SessionGC(maxLifeTime int64) // sessions's expiry garbage collector
+	// SessionBind records that the session belongs to user & is used from device
+	SessionBind(sid, user string, device Device) error
+	// SessionsByUser returns the sessions bound to user
+	SessionsByUser(user string) ([]Info, error)
+}
+
+// ErrNotSupported is returned by providers which can't look sessions up by users (e.g. stateless ones)
+var ErrNotSupported = errors.New("on looking up sessions which aren't kept on the server")
+
+// Device describes the client a session is used from
+type Device struct {
+	UserAgent string
+	IP        string
+}
+
+// Info describes a session bound to a user
+type Info struct {
+	ID       string
+	Device   Device
+	Created  time.Time // the time the session was bound to the user
+	LastSeen time.Time
+}
+
+// Handle returns an identifier of the session which can be shown to clients,
+// unlike the ID it can't be used to take over the session
+func (info Info) Handle() string {
+	return Handle(info.ID)
+}
+
+// Handle returns the identifier of the session with sid which can be shown to clients
+func Handle(sid string) string {
+	sum := sha256.Sum256([]byte(sid))
+	return hex.EncodeToString(sum[:16])
+}
+
+// StatelessProvider is a Provider keeping the data of sessions in the cookies instead of IDs of them,
+// the manager rewrites the cookie whenever such a session is changed
+type StatelessProvider interface {
+	Provider
+	// Seal returns the value of the cookie holding the data of s,
+	// SessionRead is given such values instead of IDs
+	Seal(s Session) (string, error)
 }
 
 func Register(name string, provider Provider) {
@@ -42,31 +90,61 @@ func Register(name string, provider Provider) {
 	providers[name] = provider
 }
 
+// Clock tells the current time, tests replace time.Now with it to move sessions through time
+type Clock func() time.Time
+
+// Timeouts limit the time sessions can be used for
+type Timeouts struct {
+	Idle     time.Duration // since the last access to a session
+	Absolute time.Duration // since a session was created (or regenerated) however active it is, no limit if it's zero
+}
+
+// createdKey is the key of the time (unix nano) a session was created at, kept among its values,
+// so the absolute timeout doesn't depend on a provider
+const createdKey = "SESSION_CREATED"
+
+// CookieOptions are attributes of session cookies, the cookies are always HttpOnly
+type CookieOptions struct {
+	Secure   bool // sends the cookie over HTTPS only
+	SameSite http.SameSite
+	Domain   string
+	MaxAge   int // in seconds, the cookie doesn't last after closing a browser if it's zero
+}
+
 // Manager is an API for manipulating with sessions,
-// abstracted from the internal implementation of a storage
+// abstracted from the internal implementation of a storage;
+// providers are safe for concurrent use, so the manager doesn't serialize requests
 type Manager struct {
-	provider        Provider
-	cookieName      string
-	sessionLifeTime int64
-	sync.Mutex
+	provider   Provider
+	cookieName string
+	cookie     CookieOptions
+	timeouts   Timeouts
+	clock      Clock
 }
 
-func NewManager(providerName, cookieName string, sessionLifeTime int64) (*Manager, error) {
+// NewManager returns a manager of the sessions kept by the provider registered as providerName,
+// the provider has to expire sessions after timeouts.Idle by itself as well
+func NewManager(providerName, cookieName string, timeouts Timeouts, cookie CookieOptions) (*Manager, error) {
 	provider, ok := providers[providerName]
 	if !ok {
 		return nil, fmt.Errorf("on getting an unknown provider for s: %q", providerName)
 	}
 	return &Manager{
-		provider:        provider,
-		cookieName:      cookieName,
-		sessionLifeTime: sessionLifeTime,
+		provider:   provider,
+		cookieName: cookieName,
+		cookie:     cookie,
+		timeouts:   timeouts,
+		clock:      time.Now,
 	}, nil
 }
 
+// SetClock replaces the clock the timeouts are measured with, it has to be called before the manager is used
+func (manager *Manager) SetClock(clock Clock) {
+	manager.clock = clock
+}
+
 // SessionStart an entry point for any page that rely on sessions
 func (manager *Manager) SessionStart(w http.ResponseWriter, r *http.Request) (Session, error) {
-	manager.Lock()
-	defer manager.Unlock()
 	// If a session-cookie doesn't exist, then create a new session
 	// & save it as a cookie on a client
 	cookie, err := r.Cookie(manager.cookieName)
@@ -84,14 +162,38 @@ func (manager *Manager) SessionStart(w http.ResponseWriter, r *http.Request) (Se
 	}
 	session, err := manager.provider.SessionRead(sid)
 	if err != nil {
-		session, err = manager.sessionCreate(w)
-		if err != nil {
+		return manager.sessionCreate(w)
+	}
+	session = manager.wrap(w, session)
+	if manager.expired(session) {
+		if err := manager.provider.SessionDestroy(session.GetSessionID()); err != nil {
+			return nil, err
+		}
+		return manager.sessionCreate(w)
+	}
+	// Stateless sessions are sealed anew on every request, so their idle timeout counts from the last one
+	if sealed, ok := session.(*sealedSession); ok {
+		if err := sealed.reseal(); err != nil {
 			return nil, err
 		}
 	}
 	return session, nil
 }
 
+// expired tells if s has outlived the absolute timeout,
+// sessions created before the time was kept in them are given it from now on
+func (manager *Manager) expired(s Session) bool {
+	if manager.timeouts.Absolute == 0 {
+		return false
+	}
+	created, ok := s.Get(createdKey).(int64)
+	if !ok {
+		s.Set(createdKey, manager.clock().UnixNano())
+		return false
+	}
+	return manager.clock().Sub(time.Unix(0, created)) > manager.timeouts.Absolute
+}
+
 // sessionCreate returns a newly created session (with an error)
 // and setts a cookie on a client containing that session's id
 func (manager *Manager) sessionCreate(w http.ResponseWriter) (Session, error) {
@@ -103,14 +205,106 @@ func (manager *Manager) sessionCreate(w http.ResponseWriter) (Session, error) {
 	if err != nil {
 		return nil, err
 	}
-	http.SetCookie(w, &http.Cookie{
+	if err := session.Set(createdKey, manager.clock().UnixNano()); err != nil {
+		return nil, err
+	}
+	value := sid
+	if stateless, ok := manager.provider.(StatelessProvider); ok {
+		if value, err = stateless.Seal(session); err != nil {
+			return nil, err
+		}
+	}
+	manager.setCookie(w, value)
+	return manager.wrap(w, session), nil
+}
+
+// setCookie sets the session cookie replacing the one set earlier in the same response (if any)
+func (manager *Manager) setCookie(w http.ResponseWriter, value string) {
+	header := w.Header()
+	cookies := header["Set-Cookie"]
+	header.Del("Set-Cookie")
+	for _, c := range cookies {
+		if !strings.HasPrefix(c, manager.cookieName+"=") {
+			header.Add("Set-Cookie", c)
+		}
+	}
+	http.SetCookie(w, manager.newCookie(url.QueryEscape(value)))
+}
+
+func (manager *Manager) newCookie(value string) *http.Cookie {
+	return &http.Cookie{
 		Name:     manager.cookieName,
-		Value:    url.QueryEscape(sid),
+		Value:    value,
 		Path:     "/",
-		HttpOnly: false,
-		MaxAge:   0, // a cookie won't last after closing a browser
-	})
-	return session, nil
+		Domain:   manager.cookie.Domain,
+		Secure:   manager.cookie.Secure,
+		SameSite: manager.cookie.SameSite,
+		HttpOnly: true,
+		MaxAge:   manager.cookie.MaxAge,
+	}
+}
+
+// Regenerate moves the values of s into a session with a new ID & destroys s,
+// it has to be called whenever the privileges of a session change (e.g. on logging in),
+// so an ID planted or leaked before that is of no use (session fixation),
+// the absolute timeout of the new session counts from the regeneration
+func (manager *Manager) Regenerate(w http.ResponseWriter, s Session) (Session, error) {
+	fresh, err := manager.sessionCreate(w)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range s.Keys() {
+		if key == createdKey {
+			continue
+		}
+		if err := fresh.Set(key, s.Get(key)); err != nil {
+			return nil, err
+		}
+	}
+	if err := manager.provider.SessionDestroy(s.GetSessionID()); err != nil {
+		return nil, err
+	}
+	return fresh, nil
+}
+
+// wrap makes sessions of stateless providers rewrite the cookie on changes
+func (manager *Manager) wrap(w http.ResponseWriter, s Session) Session {
+	stateless, ok := manager.provider.(StatelessProvider)
+	if !ok {
+		return s
+	}
+	return &sealedSession{Session: s, provider: stateless, manager: manager, w: w}
+}
+
+// sealedSession is a session of a StatelessProvider, its cookie is sealed anew on every change
+type sealedSession struct {
+	Session
+	provider StatelessProvider
+	manager  *Manager
+	w        http.ResponseWriter
+}
+
+func (s *sealedSession) Set(key, value interface{}) error {
+	if err := s.Session.Set(key, value); err != nil {
+		return err
+	}
+	return s.reseal()
+}
+
+func (s *sealedSession) Delete(key interface{}) error {
+	if err := s.Session.Delete(key); err != nil {
+		return err
+	}
+	return s.reseal()
+}
+
+func (s *sealedSession) reseal() error {
+	value, err := s.provider.Seal(s.Session)
+	if err != nil {
+		return err
+	}
+	s.manager.setCookie(s.w, value)
+	return nil
 }
 
 // SessionDestroy removes a session-cookie on a client (if it's present)
@@ -120,17 +314,39 @@ func (manager *Manager) SessionDestroy(w http.ResponseWriter, r *http.Request) {
 	if err != nil || cookie.Value == "" {
 		return
 	}
-	manager.Lock()
-	defer manager.Unlock()
-	manager.provider.SessionDestroy(cookie.Value)
-	expiration := time.Now()
-	http.SetCookie(w, &http.Cookie{
-		Name:     manager.cookieName,
-		Path:     "/",
-		HttpOnly: true,
-		Expires:  expiration,
-		MaxAge:   -1,
-	})
+	if sid, err := url.QueryUnescape(cookie.Value); err == nil {
+		manager.provider.SessionDestroy(sid)
+	}
+	expired := manager.newCookie("")
+	expired.Expires = time.Unix(0, 0)
+	expired.MaxAge = -1
+	http.SetCookie(w, expired)
+}
+
+// Bind records that s belongs to user & is used from device
+func (manager *Manager) Bind(s Session, user string, device Device) error {
+	return manager.provider.SessionBind(s.GetSessionID(), user, device)
+}
+
+// SessionsByUser returns the sessions of user which haven't expired
+func (manager *Manager) SessionsByUser(user string) ([]Info, error) {
+	infos, err := manager.provider.SessionsByUser(user)
+	if err != nil {
+		return nil, err
+	}
+	expired := manager.clock().Add(-manager.timeouts.Idle)
+	active := make([]Info, 0, len(infos))
+	for _, info := range infos {
+		if info.LastSeen.After(expired) {
+			active = append(active, info)
+		}
+	}
+	return active, nil
+}
+
+// Destroy purges the session with sid from the provider, so the client using it is logged out
+func (manager *Manager) Destroy(sid string) error {
+	return manager.provider.SessionDestroy(sid)
 }
 
 // createUniqueSessionID generates a unique string for our sessions
@@ -142,11 +358,17 @@ func (manager *Manager) createUniqueSessionID() (string, error) {
 	return base64.URLEncoding.EncodeToString(b), nil
 }
 
-// GC is a garbage collector for our expired sessions
-// it invokes SessionGC() method on a provider after manager.cookieLifeTime time
-func (manager *Manager) GC() {
-	manager.Lock()
-	defer manager.Unlock()
-	manager.provider.SessionGC(manager.sessionLifeTime)
-	time.AfterFunc(60*time.Second, func() { manager.GC() })
+// GC is a garbage collector for our expired sessions,
+// it invokes SessionGC() method on a provider every interval until ctx is done
+func (manager *Manager) GC(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		manager.provider.SessionGC(int64(manager.timeouts.Idle.Seconds()))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
@@ -0,0 +1,254 @@
+package session_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meddion/web-blog/pkg/session"
+	providers "github.com/meddion/web-blog/pkg/session/providers/cookie"
+	memsession "github.com/meddion/web-blog/pkg/session/providers/memory"
+)
+
+// clock is a session.Clock which is moved by tests
+type clock struct {
+	now time.Time
+	sync.Mutex
+}
+
+func (c *clock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+func (c *clock) Add(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newManager returns a manager of the memory provider registered under the name of the test
+func newManager(t *testing.T, timeouts session.Timeouts) (*session.Manager, *memsession.Provider, *clock) {
+	c := &clock{now: time.Unix(1600000000, 0)}
+	provider := memsession.New(timeouts.Idle)
+	provider.SetClock(c.Now)
+	session.Register(t.Name(), provider)
+	manager, err := session.NewManager(t.Name(), "SESSION_ID", timeouts, session.CookieOptions{Secure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.SetClock(c.Now)
+	return manager, provider, c
+}
+
+// start starts the session of the client having the cookie with sid (a new one if it's empty)
+func start(t *testing.T, manager *session.Manager, sid string) session.Session {
+	s, err := startSession(manager, sid)
+	if err != nil {
+		t.Fatalf("on starting a session: %s", err.Error())
+	}
+	return s
+}
+
+// startSession is start for goroutines other than the test one, which can't call t.Fatalf
+func startSession(manager *session.Manager, sid string) (session.Session, error) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if sid != "" {
+		r.AddCookie(&http.Cookie{Name: "SESSION_ID", Value: sid})
+	}
+	return manager.SessionStart(httptest.NewRecorder(), r)
+}
+
+func TestStatelessSessionCookie(t *testing.T) {
+	provider, err := providers.New([][]byte{bytes.Repeat([]byte{1}, 32)}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Register("cookie-test", provider)
+	manager, err := session.NewManager("cookie-test", "SESSION_ID", session.Timeouts{Idle: time.Hour}, session.CookieOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	s, err := manager.SessionStart(w, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatalf("on starting a session: %s", err.Error())
+	}
+	s.Set("USER", "alice")
+	s.Set("AUTH_TIME", int64(42))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected the cookie to be set once, instead we got: %v", cookies)
+	}
+
+	// The next request carries the data in the cookie
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "SESSION_ID", Value: cookies[0].Value})
+	s, err = manager.SessionStart(httptest.NewRecorder(), r)
+	if err != nil {
+		t.Fatalf("on starting a session: %s", err.Error())
+	}
+	if s.Get("USER") != "alice" || s.Get("AUTH_TIME") != int64(42) {
+		t.Fatalf("expected the values to be kept in the cookie, instead we got: %v, %v", s.Get("USER"), s.Get("AUTH_TIME"))
+	}
+}
+
+func TestRegenerate(t *testing.T) {
+	manager, _, _ := newManager(t, session.Timeouts{Idle: time.Hour})
+	s := start(t, manager, "")
+	s.Set("PENDING", "value")
+
+	w := httptest.NewRecorder()
+	fresh, err := manager.Regenerate(w, s)
+	if err != nil {
+		t.Fatalf("on regenerating the session: %s", err.Error())
+	}
+	if fresh.GetSessionID() == s.GetSessionID() || fresh.Get("PENDING") != "value" {
+		t.Fatalf("expected the values to be moved to a new ID, instead we got: %q, %v", fresh.GetSessionID(), fresh.Get("PENDING"))
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly || !cookies[0].Secure {
+		t.Fatalf("expected a hardened cookie of the new session, instead we got: %v", cookies)
+	}
+
+	// The old ID is of no use anymore
+	if old := start(t, manager, s.GetSessionID()); old.GetSessionID() == s.GetSessionID() || old.IsValuePresent("PENDING") {
+		t.Fatal("expected the old session to be destroyed")
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	manager, _, c := newManager(t, session.Timeouts{Idle: 30 * time.Minute})
+	s := start(t, manager, "")
+	s.Set("USER", "alice")
+	sid := s.GetSessionID() // getting the ID accesses the session as well
+
+	// Every access postpones the expiry
+	for i := 0; i < 3; i++ {
+		c.Add(20 * time.Minute)
+		if read := start(t, manager, sid); read.GetSessionID() != sid {
+			t.Fatalf("expected an active session to be kept after %d accesses", i+1)
+		}
+	}
+
+	c.Add(31 * time.Minute)
+	if read := start(t, manager, sid); read.GetSessionID() == sid || read.IsValuePresent("USER") {
+		t.Fatal("expected an idle session to expire")
+	}
+}
+
+func TestAbsoluteTimeout(t *testing.T) {
+	manager, _, c := newManager(t, session.Timeouts{Idle: 30 * time.Minute, Absolute: time.Hour})
+	s := start(t, manager, "")
+	s.Set("USER", "alice")
+	sid := s.GetSessionID()
+
+	for i := 0; i < 3; i++ {
+		c.Add(20 * time.Minute)
+		start(t, manager, sid)
+	}
+	c.Add(time.Minute)
+	if read := start(t, manager, sid); read.GetSessionID() == sid || read.IsValuePresent("USER") {
+		t.Fatal("expected an active session to expire after the absolute timeout")
+	}
+
+	// Regenerating a session starts the absolute timeout anew
+	s = start(t, manager, "")
+	c.Add(50 * time.Minute)
+	fresh, err := manager.Regenerate(httptest.NewRecorder(), s)
+	if err != nil {
+		t.Fatalf("on regenerating the session: %s", err.Error())
+	}
+	c.Add(20 * time.Minute)
+	if read := start(t, manager, fresh.GetSessionID()); read.GetSessionID() != fresh.GetSessionID() {
+		t.Fatal("expected a regenerated session to be kept")
+	}
+}
+
+func TestGC(t *testing.T) {
+	manager, provider, c := newManager(t, session.Timeouts{Idle: 30 * time.Minute})
+	old := start(t, manager, "")
+	c.Add(20 * time.Minute)
+	active := start(t, manager, "")
+	c.Add(20 * time.Minute)
+
+	// The collector runs once before it waits for the context to be done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		manager.GC(ctx, time.Hour)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the collector to stop once the context is done")
+	}
+
+	c.Add(-20 * time.Minute) // so an idle session could be read if it were kept
+	if _, err := provider.SessionRead(old.GetSessionID()); err == nil {
+		t.Fatal("expected an idle session to be collected")
+	}
+	if _, err := provider.SessionRead(active.GetSessionID()); err != nil {
+		t.Fatalf("expected an active session to be kept, instead we got: %s", err.Error())
+	}
+}
+
+func TestConcurrentSessions(t *testing.T) {
+	manager, _, c := newManager(t, session.Timeouts{Idle: 30 * time.Minute, Absolute: time.Hour})
+	shared := start(t, manager, "").GetSessionID()
+
+	const goroutines = 8
+	errs := make(chan error, goroutines)
+	for i := 0; i < goroutines; i++ {
+		go func(i int) {
+			errs <- func() error {
+				for j := 0; j < 100; j++ {
+					s, err := startSession(manager, shared)
+					if err != nil {
+						return err
+					}
+					s.Set(i, j)
+					s.Get(i)
+					s.Keys()
+					other, err := startSession(manager, "")
+					if err != nil {
+						return err
+					}
+					other.Set("USER", i)
+					c.Add(time.Millisecond)
+					if err := manager.Bind(s, "alice", session.Device{}); err != nil {
+						return err
+					}
+					if _, err := manager.SessionsByUser("alice"); err != nil {
+						return err
+					}
+				}
+				return nil
+			}()
+		}(i)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go manager.GC(ctx, time.Millisecond)
+	for i := 0; i < goroutines; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("on using sessions concurrently: %s", err.Error())
+		}
+	}
+	cancel()
+	if t.Failed() {
+		t.FailNow()
+	}
+
+	s := start(t, manager, shared)
+	if s.GetSessionID() != shared || len(s.Keys()) != 9 { // the values of every goroutine & the creation time
+		t.Fatalf("expected the values of every goroutine to be kept, instead we got: %v", s.Keys())
+	}
+}
@@ -0,0 +1,93 @@
+// Package sitemap encodes sitemaps (https://www.sitemaps.org/protocol.html) of the blog
+// & caches the URLs listed in them until the posts change
+package sitemap
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// MaxURLs is the limit of URLs in a single sitemap set by the protocol,
+// sites with more URLs have to be split & listed in a sitemap index
+const MaxURLs = 50000
+
+const xmlns = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// URL is an entry of a sitemap
+type URL struct {
+	Loc     string
+	LastMod time.Time
+}
+
+type urlSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	URLs    []*entry `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name `xml:"sitemapindex"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Sitemaps []*entry `xml:"sitemap"`
+}
+
+type entry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+func newEntry(u URL) *entry {
+	e := &entry{Loc: u.Loc}
+	if !u.LastMod.IsZero() {
+		e.LastMod = u.LastMod.UTC().Format(time.RFC3339)
+	}
+	return e
+}
+
+// Split divides urls into sitemaps of at most max URLs each
+func Split(urls []URL, max int) [][]URL {
+	var parts [][]URL
+	for len(urls) > max {
+		parts = append(parts, urls[:max])
+		urls = urls[max:]
+	}
+	return append(parts, urls)
+}
+
+// EncodeURLSet returns a sitemap listing urls
+func EncodeURLSet(urls []URL) ([]byte, error) {
+	set := &urlSet{Xmlns: xmlns, URLs: make([]*entry, 0, len(urls))}
+	for _, u := range urls {
+		set.URLs = append(set.URLs, newEntry(u))
+	}
+	return encode(set)
+}
+
+// EncodeIndex returns a sitemap index listing sitemaps,
+// LastMod of a sitemap is the time the latest of its URLs was modified at
+func EncodeIndex(sitemaps []URL) ([]byte, error) {
+	index := &sitemapIndex{Xmlns: xmlns, Sitemaps: make([]*entry, 0, len(sitemaps))}
+	for _, s := range sitemaps {
+		index.Sitemaps = append(index.Sitemaps, newEntry(s))
+	}
+	return encode(index)
+}
+
+// LastMod returns the time the latest of urls was modified at
+func LastMod(urls []URL) time.Time {
+	var last time.Time
+	for _, u := range urls {
+		if u.LastMod.After(last) {
+			last = u.LastMod
+		}
+	}
+	return last
+}
+
+func encode(v interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
@@ -0,0 +1,51 @@
+package sitemap
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	cases := []struct {
+		n, max int
+		sizes  []int
+	}{
+		{0, 3, []int{0}},
+		{3, 3, []int{3}},
+		{7, 3, []int{3, 3, 1}},
+	}
+	for _, c := range cases {
+		urls := make([]URL, c.n)
+		for i := range urls {
+			urls[i].Loc = strconv.Itoa(i)
+		}
+		parts := Split(urls, c.max)
+		if len(parts) != len(c.sizes) {
+			t.Fatalf("on splitting %d URLs by %d expected %d parts, instead we got: %d", c.n, c.max, len(c.sizes), len(parts))
+		}
+		for i, part := range parts {
+			if len(part) != c.sizes[i] {
+				t.Fatalf("on splitting %d URLs by %d expected part %d to have %d URLs, instead we got: %d", c.n, c.max, i, c.sizes[i], len(part))
+			}
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	cache := &Cache{}
+	builds := 0
+	build := func() ([]URL, error) {
+		builds++
+		return []URL{{Loc: "/"}}, nil
+	}
+	cache.Get(build)
+	cache.Get(build)
+	if builds != 1 {
+		t.Fatalf("expected URLs to be built once, instead they were built %d times", builds)
+	}
+	cache.Invalidate()
+	cache.Get(build)
+	if builds != 2 {
+		t.Fatalf("expected URLs to be built again after invalidation, instead they were built %d times", builds)
+	}
+}
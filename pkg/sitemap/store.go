@@ -0,0 +1,94 @@
+package sitemap
+
+import (
+	"context"
+	"sync"
+
+	"github.com/meddion/web-blog/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Cache keeps URLs of a sitemap until they are invalidated, a nil Cache doesn't cache anything
+type Cache struct {
+	mu    sync.Mutex
+	urls  []URL
+	valid bool
+}
+
+// Get returns the cached URLs or the ones made by build if the cache isn't valid
+func (c *Cache) Get(build func() ([]URL, error)) ([]URL, error) {
+	if c == nil {
+		return build()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.valid {
+		return c.urls, nil
+	}
+	urls, err := build()
+	if err != nil {
+		return nil, err
+	}
+	c.urls, c.valid = urls, true
+	return urls, nil
+}
+
+// Invalidate makes the next Get build the URLs again
+func (c *Cache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.urls, c.valid = nil, false
+}
+
+// Attach wraps stores.Posts & stores.Users to invalidate the returned cache
+// whenever posts or their authors change
+func Attach(stores *models.Stores) *Cache {
+	cache := &Cache{}
+	stores.Posts = &invalidatingPostStore{stores.Posts, cache}
+	stores.Users = &invalidatingUserStore{stores.Users, cache}
+	return cache
+}
+
+type invalidatingPostStore struct {
+	models.PostStore
+	cache *Cache
+}
+
+func (s *invalidatingPostStore) Save(ctx context.Context, p *models.Post) error {
+	defer s.cache.Invalidate()
+	return s.PostStore.Save(ctx, p)
+}
+
+func (s *invalidatingPostStore) Update(ctx context.Context, p *models.Post) error {
+	defer s.cache.Invalidate()
+	return s.PostStore.Update(ctx, p)
+}
+
+func (s *invalidatingPostStore) DeleteByID(ctx context.Context, id string) error {
+	defer s.cache.Invalidate()
+	return s.PostStore.DeleteByID(ctx, id)
+}
+
+func (s *invalidatingPostStore) PublishDue(ctx context.Context, now int64) ([]*models.Post, error) {
+	published, err := s.PostStore.PublishDue(ctx, now)
+	if len(published) > 0 {
+		s.cache.Invalidate()
+	}
+	return published, err
+}
+
+// invalidatingUserStore keeps author pages up to date
+type invalidatingUserStore struct {
+	models.UserStore
+	cache *Cache
+}
+
+func (s *invalidatingUserStore) Update(ctx context.Context, u *models.User) error {
+	defer s.cache.Invalidate()
+	return s.UserStore.Update(ctx, u)
+}
+
+func (s *invalidatingUserStore) DeleteByID(ctx context.Context, id primitive.ObjectID) error {
+	defer s.cache.Invalidate()
+	return s.UserStore.DeleteByID(ctx, id)
+}
@@ -0,0 +1,116 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+// MemoryStore keeps records in process memory, so it suits a single instance of the application only
+type MemoryStore struct {
+	mu        sync.Mutex
+	records   map[string]*memoryRecord
+	lastSweep time.Time
+}
+
+type memoryRecord struct {
+	Record
+	expires time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]*memoryRecord)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[key]
+	if !ok || time.Now().After(r.expires) {
+		return Record{}, nil
+	}
+	return r.Record, nil
+}
+
+func (s *MemoryStore) Reserve(ctx context.Context, key string, now time.Time, ttl time.Duration, wait func(Record) time.Duration) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+	r := s.record(key, now)
+	if left := wait(r.Record); left > 0 {
+		return left, nil
+	}
+	r.Pending++
+	if expires := now.Add(ttl); expires.After(r.expires) {
+		r.expires = expires
+	}
+	return 0, nil
+}
+
+func (s *MemoryStore) Fail(ctx context.Context, key string, now time.Time, ttl time.Duration) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+	r := s.record(key, now)
+	if r.Pending > 0 {
+		r.Pending--
+	}
+	r.Failures++
+	r.Last = now
+	r.expires = now.Add(ttl)
+	return r.Record, nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[key]
+	if !ok {
+		return nil
+	}
+	if r.Pending > 0 {
+		r.Pending--
+	}
+	if r.Failures == 0 && r.Pending == 0 {
+		delete(s.records, key)
+	}
+	return nil
+}
+
+// Reset keeps the record of key if it has pending attempts, so they are still counted
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.records[key]; ok && r.Pending > 0 {
+		r.Failures, r.Last = 0, time.Time{}
+		return nil
+	}
+	delete(s.records, key)
+	return nil
+}
+
+// record returns the record of key, creating it if there is none or it has expired
+func (s *MemoryStore) record(key string, now time.Time) *memoryRecord {
+	r, ok := s.records[key]
+	if !ok || now.After(r.expires) {
+		r = &memoryRecord{}
+		s.records[key] = r
+	}
+	return r
+}
+
+// sweep drops expired records, so keys tried once don't pile up
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, r := range s.records {
+		if now.After(r.expires) {
+			delete(s.records, key)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Package throttle slows down guessing of secrets (e.g. passwords) by locking out the keys
+// (accounts, client addresses) with too many failed attempts for exponentially growing periods
+package throttle
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Record is the history of failed attempts of a key
+type Record struct {
+	Failures int
+	Last     time.Time // the time of the last failure
+	Pending  int       // attempts reserved but not ended yet
+}
+
+// Store keeps records of keys, it may be shared by several instances of the application
+type Store interface {
+	// Get returns the record of key, the zero Record if there is none
+	Get(ctx context.Context, key string) (Record, error)
+	// Reserve calls wait with the record of key & unless it returns a positive duration (which is returned then)
+	// counts a pending attempt of key, atomically, so concurrent attempts can't all pass wait before any of them fails
+	Reserve(ctx context.Context, key string, now time.Time, ttl time.Duration, wait func(Record) time.Duration) (time.Duration, error)
+	// Fail counts a failed attempt of key made at now ending its pending attempt (if any) & returns the updated record,
+	// the record has to be kept for ttl after the last failure at least
+	Fail(ctx context.Context, key string, now time.Time, ttl time.Duration) (Record, error)
+	// Release ends a pending attempt of key without counting it as a failure
+	Release(ctx context.Context, key string) error
+	// Reset forgets the failures of key
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy describes how many failures are allowed & how long keys are locked out after that
+type Policy struct {
+	Free   int           // failures which don't lock the key out
+	Base   time.Duration // the lockout after the first failure over Free, every next one doubles it
+	Max    time.Duration // the longest lockout
+	Forget time.Duration // failures are forgotten after this time without new ones
+}
+
+// Lockout returns for how long a key with the given number of failures is locked out after the last of them
+func (p Policy) Lockout(failures int) time.Duration {
+	n := failures - p.Free - 1
+	if n < 0 {
+		return 0
+	}
+	if n >= 62 || float64(p.Base)*math.Pow(2, float64(n)) >= float64(p.Max) {
+		return p.Max
+	}
+	return p.Base << uint(n)
+}
+
+// Limiter tracks failed attempts of keys in store applying policy to them,
+// a nil Limiter never locks anything out
+type Limiter struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+// New returns a Limiter keeping records in store
+func New(store Store, policy Policy) *Limiter {
+	if policy.Forget < policy.Max {
+		policy.Forget = policy.Max
+	}
+	return &Limiter{store: store, policy: policy, now: time.Now}
+}
+
+// Check returns the time left until key may be tried again, zero if it's not locked out
+func (l *Limiter) Check(ctx context.Context, key string) (time.Duration, error) {
+	if l == nil {
+		return 0, nil
+	}
+	r, err := l.store.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return l.left(r), nil
+}
+
+// Reserve returns the time left until key may be tried again, or zero if an attempt of key is reserved,
+// the attempt has to be ended by Fail, Succeed or Release then
+func (l *Limiter) Reserve(ctx context.Context, key string) (time.Duration, error) {
+	if l == nil {
+		return 0, nil
+	}
+	return l.store.Reserve(ctx, key, l.now(), l.policy.Forget, l.wait)
+}
+
+// Fail counts a failed attempt of key & returns the lockout it has led to, zero if there is none
+func (l *Limiter) Fail(ctx context.Context, key string) (time.Duration, Record, error) {
+	if l == nil {
+		return 0, Record{}, nil
+	}
+	r, err := l.store.Fail(ctx, key, l.now(), l.policy.Forget)
+	if err != nil {
+		return 0, Record{}, err
+	}
+	return l.left(r), r, nil
+}
+
+// Succeed forgets the failures of key & ends its reserved attempt
+func (l *Limiter) Succeed(ctx context.Context, key string) error {
+	if l == nil {
+		return nil
+	}
+	if err := l.store.Reset(ctx, key); err != nil {
+		return err
+	}
+	return l.store.Release(ctx, key)
+}
+
+// Release ends a reserved attempt of key without counting it
+func (l *Limiter) Release(ctx context.Context, key string) error {
+	if l == nil {
+		return nil
+	}
+	return l.store.Release(ctx, key)
+}
+
+// wait returns the time left until a key with the record r may be tried again,
+// pending attempts are taken as failures made now, so no more attempts are made at once than one by one
+func (l *Limiter) wait(r Record) time.Duration {
+	if left := l.left(r); left > 0 || r.Pending == 0 {
+		return left
+	}
+	failures := r.Pending
+	if l.now().Sub(r.Last) <= l.policy.Forget {
+		failures += r.Failures
+	}
+	return l.policy.Lockout(failures)
+}
+
+func (l *Limiter) left(r Record) time.Duration {
+	if r.Failures == 0 || l.now().Sub(r.Last) > l.policy.Forget {
+		return 0
+	}
+	left := r.Last.Add(l.policy.Lockout(r.Failures)).Sub(l.now())
+	if left < 0 {
+		return 0
+	}
+	return left
+}
@@ -0,0 +1,106 @@
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLockout(t *testing.T) {
+	p := Policy{Free: 3, Base: time.Second, Max: time.Minute}
+	cases := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{9, 32 * time.Second},
+		{10, time.Minute},
+		{1000, time.Minute},
+	}
+	for _, c := range cases {
+		if got := p.Lockout(c.failures); got != c.expected {
+			t.Fatalf("expected a lockout after %d failures to be %v, instead we got: %v", c.failures, c.expected, got)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Now()
+	l := New(NewMemoryStore(), Policy{Free: 2, Base: time.Second, Max: time.Minute, Forget: time.Hour})
+	l.now = func() time.Time { return now }
+	ctx := context.TODO()
+
+	for i := 0; i < 2; i++ {
+		if left, _, _ := l.Fail(ctx, "alice"); left != 0 {
+			t.Fatalf("expected free failure %d not to lock out, instead we got: %v", i+1, left)
+		}
+	}
+	if left, r, _ := l.Fail(ctx, "alice"); left != time.Second || r.Failures != 3 {
+		t.Fatalf("expected a lockout for a second after 3 failures, instead we got: %v (%d failures)", left, r.Failures)
+	}
+	if left, _ := l.Check(ctx, "bob"); left != 0 {
+		t.Fatalf("expected other keys not to be locked out, instead we got: %v", left)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if left, _ := l.Check(ctx, "alice"); left != 500*time.Millisecond {
+		t.Fatalf("expected half a second of the lockout to be left, instead we got: %v", left)
+	}
+	now = now.Add(time.Second)
+	if left, _ := l.Check(ctx, "alice"); left != 0 {
+		t.Fatalf("expected the lockout to be over, instead we got: %v", left)
+	}
+	if left, _, _ := l.Fail(ctx, "alice"); left != 2*time.Second {
+		t.Fatalf("expected the next lockout to be doubled, instead we got: %v", left)
+	}
+	l.Succeed(ctx, "alice")
+	if left, _ := l.Check(ctx, "alice"); left != 0 {
+		t.Fatalf("expected a success to lift the lockout, instead we got: %v", left)
+	}
+
+	var nilLimiter *Limiter
+	if left, err := nilLimiter.Check(ctx, "alice"); left != 0 || err != nil {
+		t.Fatalf("expected a nil limiter to allow everything, instead we got: %v, %v", left, err)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	now := time.Now()
+	l := New(NewMemoryStore(), Policy{Free: 2, Base: time.Second, Max: time.Minute, Forget: time.Hour})
+	l.now = func() time.Time { return now }
+	ctx := context.TODO()
+
+	// Attempts made at once are allowed as many times as one by one: the free ones & the one leading to a lockout
+	for i := 0; i < 3; i++ {
+		if left, err := l.Reserve(ctx, "alice"); left != 0 || err != nil {
+			t.Fatalf("expected attempt %d to be reserved, instead we got: %v (%v)", i+1, left, err)
+		}
+	}
+	if left, _ := l.Reserve(ctx, "alice"); left != time.Second {
+		t.Fatalf("expected an attempt over the pending ones to wait for a second, instead we got: %v", left)
+	}
+	l.Release(ctx, "alice")
+	if left, _ := l.Reserve(ctx, "alice"); left != 0 {
+		t.Fatalf("expected a released attempt to make room for another one, instead we got: %v", left)
+	}
+	for i := 0; i < 3; i++ {
+		l.Fail(ctx, "alice")
+	}
+	if left, _ := l.Reserve(ctx, "alice"); left != time.Second {
+		t.Fatalf("expected a lockout for a second after 3 failures, instead we got: %v", left)
+	}
+
+	// A success forgets the failures but still counts the attempts pending at the moment
+	l.Reserve(ctx, "bob")
+	l.Reserve(ctx, "bob")
+	l.Succeed(ctx, "bob")
+	if r, _ := l.store.Get(ctx, "bob"); r.Pending != 1 || r.Failures != 0 {
+		t.Fatalf("expected a single pending attempt to be left, instead we got: %+v", r)
+	}
+	l.Release(ctx, "bob")
+	if r, _ := l.store.Get(ctx, "bob"); r != (Record{}) {
+		t.Fatalf("expected the record to be dropped once no attempts are pending, instead we got: %+v", r)
+	}
+}
@@ -0,0 +1,48 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// The secret of the test vectors of RFC 6238 ("12345678901234567890")
+var secret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	cases := []struct {
+		time int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, c := range cases {
+		got, err := Code(secret, Step(time.Unix(c.time, 0)))
+		if err != nil {
+			t.Fatalf("on making a code: %s", err.Error())
+		}
+		if got != c.code {
+			t.Fatalf("at %d expected code %s, instead we got: %s", c.time, c.code, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	if _, ok := Validate(secret, "081804", now.Add(Period*time.Second), 0); !ok {
+		t.Fatalf("on rejecting a code of the previous period")
+	}
+	if _, ok := Validate(secret, "081804", now.Add(2*Period*time.Second), 0); ok {
+		t.Fatalf("on accepting a code which is too old")
+	}
+	step, ok := Validate(secret, "081804", now, 0)
+	if !ok {
+		t.Fatalf("on rejecting a valid code")
+	}
+	if _, ok := Validate(secret, "081804", now, step); ok {
+		t.Fatalf("on accepting a code which was used already")
+	}
+}